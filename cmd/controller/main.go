@@ -1,17 +1,92 @@
 package main
 
 import (
+	"flag"
 	"log"
+	"net/http"
+	"regexp"
+	"strings"
+	"time"
 
 	"github.com/upstash/redis-external-dns/pkg/controller"
+	"k8s.io/apimachinery/pkg/labels"
+	"k8s.io/client-go/dynamic"
 	"k8s.io/client-go/kubernetes"
 	"k8s.io/client-go/rest"
 )
 
 func main() {
+	sources := flag.String("sources", controller.SourceService, "Comma-separated list of sources to publish DNS records for (service, ingress, gateway-httproute, gateway-grpcroute, gateway-tlsroute, dnsendpoint)")
+	cluster := flag.String("cluster-name", "", "Name of the cluster, recorded on every published endpoint; records are shared with the controllers of other clusters when set")
+	region := flag.String("cluster-region", "", "Region of the cluster, recorded on every published endpoint for geo routing")
+	clusterExpiry := flag.Duration("cluster-expiry", time.Minute, "How long the endpoints of another cluster are kept in a shared record after its controller last wrote them")
+	statusAnnotation := flag.Bool("status-annotation", false, "Write the published hostnames and endpoint count of each Service to its upstashternal-dns.alpha.kubernetes.io/status annotation")
+	domainFilter := flag.String("domain-filter", "", "Comma-separated list of zones hostnames must be within to be published; all zones when empty")
+	excludeDomains := flag.String("exclude-domains", "", "Comma-separated list of zones whose hostnames are never published")
+	regexDomainFilter := flag.String("regex-domain-filter", "", "Regular expression hostnames must match to be published")
+	regexDomainExclusion := flag.String("regex-domain-exclusion", "", "Regular expression of hostnames that are never published")
+	hostnamePolicies := flag.String("hostname-policies", "", "Path to a YAML file mapping namespaces to the hostname suffixes they may publish; any namespace may publish any hostname when unset")
+	namespaces := flag.String("namespaces", "", "Comma-separated list of namespaces to watch, each with its own informers so namespaced RBAC suffices; all namespaces when empty")
+	namespaceSelector := flag.String("namespace-selector", "", "Label selector of the namespaces whose objects are published")
+	serviceSelector := flag.String("service-selector", "", "Label selector of the Services to publish")
+	annotationPrefix := flag.String("annotation-prefix", "upstashternal-dns.alpha.kubernetes.io/", "Prefix of the annotation keys read and written by the controller")
+	externalDNSAnnotations := flag.Bool("external-dns-annotations", false, "Also honor the external-dns.alpha.kubernetes.io/hostname, ttl and target annotations")
+	metricsAddress := flag.String("metrics-address", ":8080", "Address to serve Prometheus metrics and the /healthz and /readyz probes on")
+	flag.Parse()
+
 	var config *rest.Config
 	var err error
 
+	filter := controller.DomainFilter{
+		Include: strings.Split(*domainFilter, ","),
+		Exclude: strings.Split(*excludeDomains, ","),
+	}
+	if *regexDomainFilter != "" {
+		if filter.Regex, err = regexp.Compile(*regexDomainFilter); err != nil {
+			log.Fatalf("Invalid --regex-domain-filter: %v", err)
+		}
+	}
+	if *regexDomainExclusion != "" {
+		if filter.RegexExclude, err = regexp.Compile(*regexDomainExclusion); err != nil {
+			log.Fatalf("Invalid --regex-domain-exclusion: %v", err)
+		}
+	}
+
+	options := []controller.Option{
+		controller.WithSources(strings.Split(*sources, ",")...),
+		controller.WithCluster(*cluster),
+		controller.WithRegion(*region),
+		controller.WithClusterExpiry(*clusterExpiry),
+		controller.WithStatusAnnotation(*statusAnnotation),
+		controller.WithDomainFilter(filter),
+		controller.WithAnnotationPrefix(*annotationPrefix),
+		controller.WithExternalDNSAnnotations(*externalDNSAnnotations),
+	}
+	if *namespaces != "" {
+		options = append(options, controller.WithNamespaces(strings.Split(*namespaces, ",")...))
+	}
+	if *namespaceSelector != "" {
+		selector, err := labels.Parse(*namespaceSelector)
+		if err != nil {
+			log.Fatalf("Invalid --namespace-selector: %v", err)
+		}
+		options = append(options, controller.WithNamespaceSelector(selector))
+	}
+	if *serviceSelector != "" {
+		selector, err := labels.Parse(*serviceSelector)
+		if err != nil {
+			log.Fatalf("Invalid --service-selector: %v", err)
+		}
+		options = append(options, controller.WithServiceSelector(selector))
+	}
+	if *hostnamePolicies != "" {
+		policies, err := controller.LoadHostnamePolicies(*hostnamePolicies)
+		if err != nil {
+			log.Fatal(err)
+		}
+		options = append(options, controller.WithHostnamePolicies(policies))
+	}
+
 	// Try in-cluster config first
 	config, err = rest.InClusterConfig()
 	if err != nil {
@@ -23,8 +98,25 @@ func main() {
 		log.Fatal(err)
 	}
 
+	dynamicClient, err := dynamic.NewForConfig(config)
+	if err != nil {
+		log.Fatal(err)
+	}
+
 	// Create and start controller
-	c := controller.NewController(clientset)
+	c := controller.NewController(clientset, append(options, controller.WithDynamicClient(dynamicClient))...)
+
+	// Serve metrics and health probes
+	mux := http.NewServeMux()
+	mux.Handle("/metrics", controller.MetricsHandler())
+	mux.Handle("/healthz", c.HealthzHandler())
+	mux.Handle("/readyz", c.ReadyzHandler())
+	go func() {
+		if err := http.ListenAndServe(*metricsAddress, mux); err != nil {
+			log.Fatalf("Failed to serve metrics: %v", err)
+		}
+	}()
+
 	stopCh := make(chan struct{})
 	if err := c.Run(1, stopCh); err != nil {
 		log.Fatal(err)
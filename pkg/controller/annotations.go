@@ -0,0 +1,146 @@
+package controller
+
+import (
+	"fmt"
+	"net"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// defaultAnnotationPrefix is the prefix of the annotation keys declared in
+// this package. Annotations with a configured prefix are read under these
+// keys.
+const defaultAnnotationPrefix = "upstashternal-dns.alpha.kubernetes.io/"
+
+// externalDNSAnnotationPrefix is the prefix of the external-dns annotations
+// honored with WithExternalDNSAnnotations
+const externalDNSAnnotationPrefix = "external-dns.alpha.kubernetes.io/"
+
+const (
+	// The annotation key for the TTL of the published records, in seconds or
+	// as a duration such as 1m
+	annotationTTL = defaultAnnotationPrefix + "ttl"
+	// The annotation key for comma-separated IPs, or a single hostname, to
+	// publish instead of the addresses of the resource
+	annotationTarget = defaultAnnotationPrefix + "target"
+)
+
+// externalDNSAnnotations maps the external-dns annotations honored for
+// compatibility to the keys they are read under
+var externalDNSAnnotations = map[string]string{
+	externalDNSAnnotationPrefix + "hostname": annotationHostname,
+	externalDNSAnnotationPrefix + "ttl":      annotationTTL,
+	externalDNSAnnotationPrefix + "target":   annotationTarget,
+}
+
+// defaultRecordTTL is the TTL of records without a TTL annotation
+const defaultRecordTTL = 10
+
+// WithAnnotationPrefix sets the prefix of the annotation keys read and
+// written by the controller, upstashternal-dns.alpha.kubernetes.io/ by
+// default. Annotations with the default prefix are ignored once another
+// prefix is set.
+func WithAnnotationPrefix(prefix string) Option {
+	return func(c *Controller) {
+		if prefix != "" && !strings.HasSuffix(prefix, "/") {
+			prefix += "/"
+		}
+		c.annotationPrefix = prefix
+	}
+}
+
+// WithExternalDNSAnnotations also honors the external-dns hostname, ttl and
+// target annotations, so resources annotated for external-dns are published
+// without the enabled annotation. The annotations of the controller take
+// precedence.
+func WithExternalDNSAnnotations(enabled bool) Option {
+	return func(c *Controller) {
+		c.externalDNSAnnotations = enabled
+	}
+}
+
+// annotationKey returns the key an annotation declared in this package is
+// read and written under, with the configured prefix
+func (c *Controller) annotationKey(key string) string {
+	if c.annotationPrefix == "" {
+		return key
+	}
+	return c.annotationPrefix + strings.TrimPrefix(key, defaultAnnotationPrefix)
+}
+
+// annotations returns the annotations of a resource keyed as declared in this
+// package: annotations with the configured prefix are renamed to the default
+// prefix, and external-dns annotations fill in those not set when enabled.
+func (c *Controller) annotations(annotations map[string]string) map[string]string {
+	prefix := c.annotationPrefix
+	if prefix == "" {
+		prefix = defaultAnnotationPrefix
+	}
+
+	normalized := make(map[string]string, len(annotations))
+	for key, value := range annotations {
+		switch {
+		case strings.HasPrefix(key, prefix):
+			normalized[defaultAnnotationPrefix+strings.TrimPrefix(key, prefix)] = value
+		case strings.HasPrefix(key, defaultAnnotationPrefix), strings.HasPrefix(key, externalDNSAnnotationPrefix):
+			// Only read under the configured prefix, or for compatibility
+		default:
+			normalized[key] = value
+		}
+	}
+
+	if c.externalDNSAnnotations {
+		for key, value := range annotations {
+			if mapped, ok := externalDNSAnnotations[key]; ok {
+				if _, set := normalized[mapped]; !set {
+					normalized[mapped] = value
+				}
+			}
+		}
+		if _, ok := annotations[externalDNSAnnotationPrefix+"hostname"]; ok {
+			if _, set := normalized[annotationEnabled]; !set {
+				normalized[annotationEnabled] = "true"
+			}
+		}
+	}
+	return normalized
+}
+
+// recordTTL returns the TTL annotated on a resource, in seconds
+func recordTTL(annotations map[string]string) (int, error) {
+	value, ok := annotations[annotationTTL]
+	if !ok {
+		return defaultRecordTTL, nil
+	}
+
+	if seconds, err := strconv.Atoi(value); err == nil && seconds > 0 {
+		return seconds, nil
+	}
+	if d, err := time.ParseDuration(value); err == nil && d >= time.Second {
+		return int(d / time.Second), nil
+	}
+	return 0, fmt.Errorf("invalid ttl %q", value)
+}
+
+// parseTargets splits the target annotation into the IPs to publish, or the
+// single hostname to publish as a CNAME
+func parseTargets(value string) (ips []string, cname string, err error) {
+	for _, target := range parseHostnames(value) {
+		if net.ParseIP(target) != nil {
+			ips = append(ips, target)
+			continue
+		}
+		if cname != "" {
+			return nil, "", fmt.Errorf("invalid target %q: only one hostname target is allowed", value)
+		}
+		if err := validateHostname(target); err != nil {
+			return nil, "", fmt.Errorf("invalid target %q: %v", value, err)
+		}
+		cname = target
+	}
+	if len(ips) > 0 && cname != "" {
+		return nil, "", fmt.Errorf("invalid target %q: IP and hostname targets cannot be mixed", value)
+	}
+	return ips, cname, nil
+}
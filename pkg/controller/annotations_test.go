@@ -0,0 +1,148 @@
+package controller
+
+import (
+	"reflect"
+	"testing"
+)
+
+func TestAnnotations(t *testing.T) {
+	tests := []struct {
+		name        string
+		options     []Option
+		annotations map[string]string
+		expected    map[string]string
+	}{
+		{
+			name: "default prefix",
+			annotations: map[string]string{
+				annotationEnabled:                      "true",
+				annotationHostname:                     "web.example.com",
+				"external-dns.alpha.kubernetes.io/ttl": "60",
+				"app":                                  "web",
+			},
+			expected: map[string]string{
+				annotationEnabled:  "true",
+				annotationHostname: "web.example.com",
+				"app":              "web",
+			},
+		},
+		{
+			name:    "custom prefix",
+			options: []Option{WithAnnotationPrefix("dns.example.com")},
+			annotations: map[string]string{
+				"dns.example.com/enabled":  "true",
+				"dns.example.com/hostname": "web.example.com",
+				annotationHostname:         "ignored.example.com",
+			},
+			expected: map[string]string{
+				annotationEnabled:  "true",
+				annotationHostname: "web.example.com",
+			},
+		},
+		{
+			name:    "external-dns",
+			options: []Option{WithExternalDNSAnnotations(true)},
+			annotations: map[string]string{
+				"external-dns.alpha.kubernetes.io/hostname": "web.example.com",
+				"external-dns.alpha.kubernetes.io/ttl":      "60",
+				"external-dns.alpha.kubernetes.io/target":   "203.0.113.10",
+				annotationTTL: "30",
+			},
+			expected: map[string]string{
+				annotationEnabled:  "true",
+				annotationHostname: "web.example.com",
+				annotationTTL:      "30",
+				annotationTarget:   "203.0.113.10",
+			},
+		},
+		{
+			name:    "external-dns with the enabled annotation off",
+			options: []Option{WithExternalDNSAnnotations(true)},
+			annotations: map[string]string{
+				"external-dns.alpha.kubernetes.io/hostname": "web.example.com",
+				annotationEnabled: "false",
+			},
+			expected: map[string]string{
+				annotationEnabled:  "false",
+				annotationHostname: "web.example.com",
+			},
+		},
+	}
+
+	for _, tc := range tests {
+		c := &Controller{}
+		for _, opt := range tc.options {
+			opt(c)
+		}
+		if got := c.annotations(tc.annotations); !reflect.DeepEqual(got, tc.expected) {
+			t.Errorf("%s: expected %v, got %v", tc.name, tc.expected, got)
+		}
+	}
+
+	c := &Controller{}
+	WithAnnotationPrefix("dns.example.com/")(c)
+	if got := c.annotationKey(annotationStatus); got != "dns.example.com/status" {
+		t.Errorf("expected the status annotation under the custom prefix, got %s", got)
+	}
+}
+
+func TestRecordTTL(t *testing.T) {
+	tests := []struct {
+		value     string
+		expected  int
+		shouldErr bool
+	}{
+		{value: "", expected: defaultRecordTTL},
+		{value: "60", expected: 60},
+		{value: "5m", expected: 300},
+		{value: "0", shouldErr: true},
+		{value: "500ms", shouldErr: true},
+		{value: "soon", shouldErr: true},
+	}
+
+	for _, tc := range tests {
+		annotations := map[string]string{}
+		if tc.value != "" {
+			annotations[annotationTTL] = tc.value
+		}
+		got, err := recordTTL(annotations)
+		if tc.shouldErr {
+			if err == nil {
+				t.Errorf("%q: expected error", tc.value)
+			}
+			continue
+		}
+		if err != nil || got != tc.expected {
+			t.Errorf("%q: expected %d, got %d (%v)", tc.value, tc.expected, got, err)
+		}
+	}
+}
+
+func TestParseTargets(t *testing.T) {
+	tests := []struct {
+		value     string
+		ips       []string
+		cname     string
+		shouldErr bool
+	}{
+		{value: ""},
+		{value: "203.0.113.10, 2001:db8::10", ips: []string{"203.0.113.10", "2001:db8::10"}},
+		{value: "LB.Example.com.", cname: "lb.example.com"},
+		{value: "a.example.com,b.example.com", shouldErr: true},
+		{value: "203.0.113.10,lb.example.com", shouldErr: true},
+		{value: "not a host", shouldErr: true},
+	}
+
+	for _, tc := range tests {
+		ips, cname, err := parseTargets(tc.value)
+		if tc.shouldErr {
+			if err == nil {
+				t.Errorf("%q: expected error", tc.value)
+			}
+			continue
+		}
+		if err != nil || !reflect.DeepEqual(ips, tc.ips) || cname != tc.cname {
+			t.Errorf("%q: expected %v %q, got %v %q (%v)", tc.value, tc.ips, tc.cname, ips, cname, err)
+		}
+	}
+}
@@ -0,0 +1,183 @@
+package controller
+
+import (
+	"fmt"
+	"sort"
+	"strings"
+	"time"
+
+	redisClient "github.com/upstash/redis-external-dns/pkg/redis"
+	corev1 "k8s.io/api/core/v1"
+)
+
+const (
+	// The annotation key for the cluster whose endpoints are served while healthy
+	annotationFailoverPrimary = "upstashternal-dns.alpha.kubernetes.io/failover-primary"
+	// The annotation key for the comma-separated clusters to fail over to, in
+	// order of preference
+	annotationFailoverSecondaries = "upstashternal-dns.alpha.kubernetes.io/failover-secondaries"
+	// The annotation key for how long a cluster may go without a heartbeat
+	// before it is considered unhealthy
+	annotationFailoverStaleAfter = "upstashternal-dns.alpha.kubernetes.io/failover-stale-after"
+)
+
+// defaultClusterExpiry is how long the endpoints of a cluster are kept in a
+// shared record after its controller last wrote them
+const defaultClusterExpiry = time.Minute
+
+// defaultFailoverStaleAfter is how long a cluster may go without a heartbeat
+// before the failover policy stops serving it
+const defaultFailoverStaleAfter = 30 * time.Second
+
+// failoverPolicy returns the failover policy annotated on a service, if any
+func failoverPolicy(service *corev1.Service) (*redisClient.FailoverPolicy, error) {
+	primary := service.Annotations[annotationFailoverPrimary]
+	if primary == "" {
+		return nil, nil
+	}
+
+	staleAfter := defaultFailoverStaleAfter
+	if value, ok := service.Annotations[annotationFailoverStaleAfter]; ok {
+		d, err := time.ParseDuration(value)
+		if err != nil || d < time.Second {
+			return nil, fmt.Errorf("invalid failover stale after %q for service %s/%s", value, service.Namespace, service.Name)
+		}
+		staleAfter = d
+	}
+
+	var secondaries []string
+	for _, cluster := range strings.Split(service.Annotations[annotationFailoverSecondaries], ",") {
+		if cluster = strings.TrimSpace(cluster); cluster != "" && cluster != primary {
+			secondaries = appendUnique(secondaries, cluster)
+		}
+	}
+
+	return &redisClient.FailoverPolicy{
+		Primary:     primary,
+		Secondaries: secondaries,
+		StaleAfter:  int(staleAfter / time.Second),
+	}, nil
+}
+
+// mergeRecord combines the record published by cluster with the endpoints the
+// other clusters published for the same hostname. Clusters whose heartbeat is
+// older than expiry are dropped. Each cluster declares its own failover
+// policy, so a cluster publishing without one withdraws the policy it declared
+// before while those of the other clusters stay in place.
+func mergeRecord(record, existing *redisClient.DNSRecord, cluster string, now time.Time, expiry time.Duration) *redisClient.DNSRecord {
+	merged := *record
+	merged.Endpoints = clusterEndpoints(record, cluster)
+	merged.Clusters = map[string]redisClient.ClusterState{
+		cluster: {Heartbeat: now, UpdatedAt: record.UpdatedAt, Policy: record.Policy},
+	}
+
+	if existing != nil {
+		for name, state := range existing.Clusters {
+			if name == cluster || now.Sub(state.Heartbeat) > expiry {
+				continue
+			}
+			merged.Clusters[name] = state
+			for _, endpoint := range existing.Endpoints {
+				if endpoint.Cluster == name {
+					merged.Endpoints = append(merged.Endpoints, endpoint)
+				}
+			}
+		}
+	}
+
+	merged.IPs = mergedIPs(merged.Endpoints)
+	merged.Policy = clustersPolicy(merged.Clusters)
+	return &merged
+}
+
+// withdrawRecord removes the endpoints of cluster from a shared record. It
+// returns nil when no other cluster is left publishing the hostname.
+func withdrawRecord(existing *redisClient.DNSRecord, cluster string, now time.Time, expiry time.Duration) *redisClient.DNSRecord {
+	if existing == nil {
+		return nil
+	}
+
+	withdrawn := *existing
+	withdrawn.Endpoints = nil
+	withdrawn.Clusters = make(map[string]redisClient.ClusterState)
+	for name, state := range existing.Clusters {
+		if name == cluster || now.Sub(state.Heartbeat) > expiry {
+			continue
+		}
+		withdrawn.Clusters[name] = state
+		for _, endpoint := range existing.Endpoints {
+			if endpoint.Cluster == name {
+				withdrawn.Endpoints = append(withdrawn.Endpoints, endpoint)
+			}
+		}
+	}
+
+	if len(withdrawn.Clusters) == 0 {
+		return nil
+	}
+	withdrawn.IPs = mergedIPs(withdrawn.Endpoints)
+	withdrawn.Policy = clustersPolicy(withdrawn.Clusters)
+	return &withdrawn
+}
+
+// clusterRecord returns the part of a shared record published by cluster, as
+// it was before being merged with the other clusters
+func clusterRecord(existing *redisClient.DNSRecord, cluster string) *redisClient.DNSRecord {
+	record := *existing
+	record.Endpoints = nil
+	for _, endpoint := range existing.Endpoints {
+		if endpoint.Cluster == cluster {
+			record.Endpoints = append(record.Endpoints, endpoint)
+		}
+	}
+	record.IPs = endpointIPs(record.Endpoints)
+	record.UpdatedAt = existing.Clusters[cluster].UpdatedAt
+	record.Policy = existing.Clusters[cluster].Policy
+	record.Clusters = nil
+	return &record
+}
+
+// clustersPolicy returns the failover policy of a shared record: the one
+// declared by the first cluster in name order that declares one, so clusters
+// disagreeing on the policy do not make it change on every write
+func clustersPolicy(clusters map[string]redisClient.ClusterState) *redisClient.FailoverPolicy {
+	names := make([]string, 0, len(clusters))
+	for name := range clusters {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	for _, name := range names {
+		if policy := clusters[name].Policy; policy != nil {
+			return policy
+		}
+	}
+	return nil
+}
+
+// clusterEndpoints returns the endpoints of a record labelled with cluster.
+// Records without endpoint metadata get one endpoint per IP.
+func clusterEndpoints(record *redisClient.DNSRecord, cluster string) []redisClient.Endpoint {
+	var endpoints []redisClient.Endpoint
+	if len(record.Endpoints) == 0 {
+		for _, ip := range record.IPs {
+			endpoints = append(endpoints, redisClient.Endpoint{IP: ip})
+		}
+	} else {
+		endpoints = append(endpoints, record.Endpoints...)
+	}
+
+	for i := range endpoints {
+		endpoints[i].Cluster = cluster
+	}
+	return endpoints
+}
+
+// mergedIPs returns the sorted unique IPs of endpoints from several clusters
+func mergedIPs(endpoints []redisClient.Endpoint) []string {
+	var ips []string
+	for _, endpoint := range endpoints {
+		ips = appendUnique(ips, endpoint.IP)
+	}
+	sort.Strings(ips)
+	return ips
+}
@@ -0,0 +1,94 @@
+package controller
+
+import (
+	"reflect"
+	"testing"
+	"time"
+
+	"github.com/upstash/redis-external-dns/pkg/redis"
+)
+
+func TestMergeRecord(t *testing.T) {
+	now := time.Now()
+	existing := &redis.DNSRecord{
+		IPs: []string{"10.0.0.1", "10.1.0.1", "10.2.0.1"},
+		Endpoints: []redis.Endpoint{
+			{IP: "10.0.0.1", Cluster: "east"},
+			{IP: "10.1.0.1", Cluster: "west"},
+			{IP: "10.2.0.1", Cluster: "gone"},
+		},
+		Clusters: map[string]redis.ClusterState{
+			"east": {Heartbeat: now.Add(-10 * time.Second)},
+			"west": {Heartbeat: now.Add(-10 * time.Second), Policy: &redis.FailoverPolicy{Primary: "east"}},
+			"gone": {Heartbeat: now.Add(-10 * time.Minute)},
+		},
+		Policy: &redis.FailoverPolicy{Primary: "east"},
+	}
+	record := &redis.DNSRecord{IPs: []string{"10.0.0.2"}, UpdatedAt: now}
+
+	merged := mergeRecord(record, existing, "east", now, time.Minute)
+
+	if expected := []string{"10.0.0.2", "10.1.0.1"}; !reflect.DeepEqual(merged.IPs, expected) {
+		t.Errorf("expected IPs %v, got %v", expected, merged.IPs)
+	}
+	if _, ok := merged.Clusters["gone"]; ok {
+		t.Errorf("expected expired cluster to be dropped, got %v", merged.Clusters)
+	}
+	if !merged.Clusters["east"].Heartbeat.Equal(now) {
+		t.Errorf("expected heartbeat of east to be refreshed, got %v", merged.Clusters["east"])
+	}
+	if merged.Policy == nil || merged.Policy.Primary != "east" {
+		t.Errorf("expected the policy of west to be kept, got %+v", merged.Policy)
+	}
+	if len(record.Endpoints) != 0 {
+		t.Errorf("expected the published record to be left unchanged, got %v", record.Endpoints)
+	}
+}
+
+func TestMergeRecordRemovesPolicy(t *testing.T) {
+	now := time.Now()
+	policy := &redis.FailoverPolicy{Primary: "east", Secondaries: []string{"west"}}
+	record := &redis.DNSRecord{IPs: []string{"10.0.0.1"}, UpdatedAt: now, Policy: policy}
+
+	merged := mergeRecord(record, nil, "east", now, time.Minute)
+	if !reflect.DeepEqual(merged.Policy, policy) {
+		t.Fatalf("expected policy %+v, got %+v", policy, merged.Policy)
+	}
+
+	// The failover annotations were removed from the service
+	record = &redis.DNSRecord{IPs: []string{"10.0.0.1"}, UpdatedAt: now}
+	merged = mergeRecord(record, merged, "east", now, time.Minute)
+	if merged.Policy != nil {
+		t.Errorf("expected the policy to be removed, got %+v", merged.Policy)
+	}
+	if clusterRecord(merged, "east").Policy != nil {
+		t.Errorf("expected east to declare no policy, got %+v", merged.Clusters["east"].Policy)
+	}
+}
+
+func TestWithdrawRecord(t *testing.T) {
+	now := time.Now()
+	existing := &redis.DNSRecord{
+		IPs: []string{"10.0.0.1", "10.1.0.1"},
+		Endpoints: []redis.Endpoint{
+			{IP: "10.0.0.1", Cluster: "east"},
+			{IP: "10.1.0.1", Cluster: "west"},
+		},
+		Clusters: map[string]redis.ClusterState{
+			"east": {Heartbeat: now},
+			"west": {Heartbeat: now},
+		},
+	}
+
+	withdrawn := withdrawRecord(existing, "east", now, time.Minute)
+	if withdrawn == nil {
+		t.Fatal("expected the endpoints of west to be kept")
+	}
+	if expected := []string{"10.1.0.1"}; !reflect.DeepEqual(withdrawn.IPs, expected) {
+		t.Errorf("expected IPs %v, got %v", expected, withdrawn.IPs)
+	}
+
+	if record := withdrawRecord(withdrawn, "west", now, time.Minute); record != nil {
+		t.Errorf("expected the record to be deleted with its last cluster, got %+v", record)
+	}
+}
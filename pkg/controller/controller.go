@@ -2,21 +2,29 @@ package controller
 
 import (
 	"context"
+	"errors"
 	"fmt"
 	"log"
 	"os"
+	"sort"
+	"strconv"
+	"strings"
 	"time"
 
 	"github.com/joho/godotenv"
 	redisClient "github.com/upstash/redis-external-dns/pkg/redis"
 	corev1 "k8s.io/api/core/v1"
+	discoveryv1 "k8s.io/api/discovery/v1"
 	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/labels"
 	"k8s.io/apimachinery/pkg/runtime"
 	utilruntime "k8s.io/apimachinery/pkg/util/runtime"
 	"k8s.io/apimachinery/pkg/util/wait"
 	"k8s.io/apimachinery/pkg/watch"
+	"k8s.io/client-go/dynamic"
 	"k8s.io/client-go/kubernetes"
 	"k8s.io/client-go/tools/cache"
+	"k8s.io/client-go/tools/record"
 	"k8s.io/client-go/util/workqueue"
 	"k8s.io/klog/v2"
 )
@@ -26,20 +34,137 @@ const (
 	annotationEnabled = "upstashternal-dns.alpha.kubernetes.io/enabled"
 	// The annotation key for the hostname
 	annotationHostname = "upstashternal-dns.alpha.kubernetes.io/hostname"
+	// The annotation key for the relative weight of the service endpoints.
+	// It applies to every endpoint of the service, as EndpointSlices carry no
+	// weights, so it only shifts answers between clusters sharing a record.
+	annotationWeight = "upstashternal-dns.alpha.kubernetes.io/weight"
+	// The annotation key for the TXT record content, one string per line
+	annotationTXT = "upstashternal-dns.alpha.kubernetes.io/txt"
 )
 
+// Source names accepted by WithSources
+const (
+	SourceService          = "service"
+	SourceIngress          = "ingress"
+	SourceGatewayHTTPRoute = "gateway-httproute"
+	SourceGatewayGRPCRoute = "gateway-grpcroute"
+	SourceGatewayTLSRoute  = "gateway-tlsroute"
+	SourceDNSEndpoint      = "dnsendpoint"
+)
+
+// errConflict is returned when a hostname is already published by another resource
+var errConflict = errors.New("hostname owned by another resource")
+
+// source publishes DNS records for one kind of Kubernetes object, with an
+// informer per watched namespace
+type source struct {
+	informers []cache.SharedIndexInformer
+	sync      func(key string) error
+	reconcile func() error
+}
+
+// queueItem identifies an object of a given source in the work queue
+type queueItem struct {
+	source string
+	key    string
+}
+
 // Controller watches Kubernetes Services and updates Redis DNS records
 type Controller struct {
 	client    kubernetes.Interface
-	informer  cache.SharedIndexInformer
+	dynamic   dynamic.Interface
+	sources   map[string]*source
+	informers []cache.SharedIndexInformer
 	queue     workqueue.RateLimitingInterface
-	namespace string
+	cluster   string
+	region    string
 	redis     redisClient.Client
 	stopCh    chan struct{}
+
+	// published tracks the hostnames this controller published, for metrics
+	published *publishedSet
+	// health tracks what the health and readiness endpoints report
+	health healthState
+
+	// recorder records events on the published resources; events tracks the
+	// last one of each so periodic syncs do not repeat them
+	recorder record.EventRecorder
+	events   eventLog
+	// statusAnnotation enables writing the publication status of services
+	statusAnnotation bool
+	// domainFilter restricts the hostnames that may be published
+	domainFilter DomainFilter
+	// policies restrict the hostnames each namespace may publish; the
+	// namespace informer caches namespace labels for their selectors
+	policies          *HostnamePolicies
+	namespaceInformer cache.SharedIndexInformer
+
+	// namespaces are the namespaces watched, all of them when empty; the
+	// selectors further restrict the namespaces and Services published
+	namespaces        []string
+	namespaceSelector labels.Selector
+	serviceSelector   labels.Selector
+
+	// clusterExpiry is how long the endpoints of another cluster are kept in a
+	// shared record after its controller last wrote them
+	clusterExpiry time.Duration
+
+	// annotationPrefix replaces the default prefix of the annotation keys, and
+	// externalDNSAnnotations also honors the external-dns annotations
+	annotationPrefix       string
+	externalDNSAnnotations bool
+
+	enabledSources   []string
+	gatewayInformers []cache.SharedIndexInformer
+}
+
+// Option configures the controller
+type Option func(*Controller)
+
+// WithSources sets the kinds of objects DNS records are published for.
+// Services are the only source enabled by default.
+func WithSources(sources ...string) Option {
+	return func(c *Controller) {
+		c.enabledSources = sources
+	}
+}
+
+// WithCluster sets the name of the cluster the controller runs in, recorded
+// on every published endpoint. Controllers with a cluster name share the
+// records of a hostname with the controllers of other clusters, each
+// publishing its own endpoints instead of replacing the whole record.
+func WithCluster(name string) Option {
+	return func(c *Controller) {
+		c.cluster = name
+	}
+}
+
+// WithRegion sets the region of the cluster the controller runs in, recorded
+// on every published endpoint so clients can be answered from the nearest one
+func WithRegion(name string) Option {
+	return func(c *Controller) {
+		c.region = name
+	}
+}
+
+// WithClusterExpiry sets how long the endpoints of another cluster are kept
+// in a shared record after its controller last wrote them
+func WithClusterExpiry(expiry time.Duration) Option {
+	return func(c *Controller) {
+		c.clusterExpiry = expiry
+	}
+}
+
+// WithDynamicClient sets the client used to watch resources without typed
+// clients, such as Gateway API routes and DNSEndpoints
+func WithDynamicClient(client dynamic.Interface) Option {
+	return func(c *Controller) {
+		c.dynamic = client
+	}
 }
 
 // NewController creates a new DNS controller
-func NewController(client kubernetes.Interface) *Controller {
+func NewController(client kubernetes.Interface, options ...Option) *Controller {
 	if err := godotenv.Load("../../.env.test"); err != nil {
 		log.Printf("Warning: .env.test file not found")
 	}
@@ -50,52 +175,123 @@ func NewController(client kubernetes.Interface) *Controller {
 	}
 
 	c := &Controller{
-		client:    client,
-		queue:     workqueue.NewRateLimitingQueue(workqueue.DefaultControllerRateLimiter()),
-		namespace: metav1.NamespaceAll,
-		redis:     redisClient,
-		stopCh:    make(chan struct{}),
-	}
-
-	// Create the service informer
-	c.informer = cache.NewSharedIndexInformer(
-		&cache.ListWatch{
-			ListFunc: func(options metav1.ListOptions) (runtime.Object, error) {
-				return client.CoreV1().Services(c.namespace).List(context.TODO(), options)
-			},
-			WatchFunc: func(options metav1.ListOptions) (watch.Interface, error) {
-				return client.CoreV1().Services(c.namespace).Watch(context.TODO(), options)
-			},
-		},
-		&corev1.Service{},
-		0, // Skip resync
-		cache.Indexers{},
-	)
-
-	// Add event handlers
-	c.informer.AddEventHandler(cache.ResourceEventHandlerFuncs{
-		AddFunc:    c.handleAdd,
-		UpdateFunc: c.handleUpdate,
-		DeleteFunc: c.handleDelete,
-	})
+		client:  client,
+		sources: make(map[string]*source),
+		queue: workqueue.NewRateLimitingQueueWithConfig(workqueue.DefaultControllerRateLimiter(), workqueue.RateLimitingQueueConfig{
+			Name: "upstashternal-dns",
+		}),
+		redis:          instrumentedRedis{redisClient},
+		published:      newPublishedSet(),
+		stopCh:         make(chan struct{}),
+		enabledSources: []string{SourceService},
+		clusterExpiry:  defaultClusterExpiry,
+		recorder:       newRecorder(client),
+	}
+
+	for _, opt := range options {
+		opt(c)
+	}
+
+	if c.namespaceSelector != nil || (c.policies != nil && c.policies.usesLabels()) {
+		c.namespaceInformer = c.newNamespaceInformer()
+		c.informers = append(c.informers, c.namespaceInformer)
+	}
+
+	for _, name := range c.enabledSources {
+		var src *source
+		switch name {
+		case SourceService:
+			src = c.newServiceSource()
+		case SourceIngress:
+			src = c.newIngressSource()
+		case SourceGatewayHTTPRoute, SourceGatewayGRPCRoute, SourceGatewayTLSRoute:
+			if c.dynamic == nil {
+				log.Fatalf("Source %q requires a dynamic client", name)
+			}
+			src = c.newGatewayRouteSource(name)
+		case SourceDNSEndpoint:
+			if c.dynamic == nil {
+				log.Fatalf("Source %q requires a dynamic client", name)
+			}
+			src = c.newDNSEndpointSource()
+		default:
+			log.Fatalf("Unknown source %q", name)
+		}
+		c.sources[name] = src
+		c.informers = append(c.informers, src.informers...)
+	}
 
 	return c
 }
 
+// newServiceSource creates the source publishing records for annotated Services
+func (c *Controller) newServiceSource() *source {
+	src := &source{
+		sync:      c.syncService,
+		reconcile: c.reconcileAllServices,
+	}
+
+	for _, namespace := range c.watchedNamespaces() {
+		namespace := namespace
+		// Create the service informer
+		informer := cache.NewSharedIndexInformer(
+			&cache.ListWatch{
+				ListFunc: func(options metav1.ListOptions) (runtime.Object, error) {
+					c.serviceListOptions(&options)
+					return c.client.CoreV1().Services(namespace).List(context.TODO(), options)
+				},
+				WatchFunc: func(options metav1.ListOptions) (watch.Interface, error) {
+					c.serviceListOptions(&options)
+					return c.client.CoreV1().Services(namespace).Watch(context.TODO(), options)
+				},
+			},
+			&corev1.Service{},
+			0, // Skip resync
+			cache.Indexers{},
+		)
+
+		// Add event handlers
+		informer.AddEventHandler(cache.ResourceEventHandlerFuncs{
+			AddFunc:    c.handleAdd,
+			UpdateFunc: c.handleUpdate,
+			DeleteFunc: c.handleDelete,
+		})
+		src.informers = append(src.informers, informer)
+	}
+
+	return src
+}
+
 // Run starts the controller
 func (c *Controller) Run(workers int, stopCh <-chan struct{}) error {
 	defer utilruntime.HandleCrash()
 	defer c.queue.ShutDown()
 
-	klog.Info("Starting Service controller")
+	klog.Infof("Starting DNS controller with sources %v", c.enabledSources)
 
-	// Start the informer
-	go c.informer.Run(stopCh)
+	// Check Redis connectivity for readiness while the controller runs
+	go wait.Until(c.checkRedis, redisCheckInterval, stopCh)
+
+	// Start the informers
+	var synced []cache.InformerSynced
+	for _, informer := range c.informers {
+		go informer.Run(stopCh)
+		synced = append(synced, informer.HasSynced)
+	}
 
 	klog.Info("Waiting for informer caches to sync")
-	if ok := cache.WaitForCacheSync(stopCh, c.informer.HasSynced); !ok {
+	if ok := cache.WaitForCacheSync(stopCh, synced...); !ok {
 		return fmt.Errorf("failed to wait for caches to sync")
 	}
+	c.health.setSynced()
+
+	// Move records written under the keys of earlier versions before they are
+	// updated; records left behind on failure expire with their TTL
+	if migrated, err := c.redis.MigrateKeys(context.TODO()); err != nil {
+		klog.Errorf("Error migrating Redis keys: %v", err)
+	} else if migrated > 0 {
+		klog.Infof("Migrated %d Redis keys to the canonical format", migrated)
+	}
 
 	klog.Info("Starting workers")
 	for i := 0; i < workers; i++ {
@@ -103,7 +299,16 @@ func (c *Controller) Run(workers int, stopCh <-chan struct{}) error {
 	}
 
 	// Add periodic reconciliation
-	go wait.Until(c.reconcileAllServices, 5*time.Second, stopCh)
+	for name, src := range c.sources {
+		name, src := name, src
+		go wait.Until(func() {
+			if err := src.reconcile(); err != nil {
+				klog.Errorf("Error reconciling %s: %v", name, err)
+				return
+			}
+			lastReconcile.WithLabelValues(name).SetToCurrentTime()
+		}, 5*time.Second, stopCh)
+	}
 
 	klog.Info("Started workers")
 	<-stopCh
@@ -120,32 +325,125 @@ func (c *Controller) runWorker() {
 
 func (c *Controller) processNextItem() bool {
 	// Get next item from queue
-	key, quit := c.queue.Get()
+	obj, quit := c.queue.Get()
 	if quit {
 		return false
 	}
-	defer c.queue.Done(key)
+	defer c.queue.Done(obj)
+
+	item := obj.(queueItem)
+	src, ok := c.sources[item.source]
+	if !ok {
+		klog.Errorf("Dropping %s %v: source not enabled", item.source, item.key)
+		c.queue.Forget(obj)
+		return true
+	}
 
 	// Process the item
-	err := c.syncService(key.(string))
+	start := time.Now()
+	c.health.startSync(item, start)
+	err := src.sync(item.key)
+	c.health.finishSync(item)
+	result := syncResult(err)
+	syncTotal.WithLabelValues(item.source, result).Inc()
+	syncDuration.WithLabelValues(item.source, result).Observe(time.Since(start).Seconds())
 	if err != nil {
-		klog.Errorf("Error syncing service %v: %v", key, err)
-		c.queue.AddRateLimited(key)
+		klog.Errorf("Error syncing %s %v: %v", item.source, item.key, err)
+		c.queue.AddRateLimited(obj)
 		return true
 	}
 
-	c.queue.Forget(key)
+	c.queue.Forget(obj)
 	return true
 }
 
-// Event handlers
-func (c *Controller) handleAdd(obj interface{}) {
+// enqueue adds an object of the given source to the work queue
+func (c *Controller) enqueue(source string, obj interface{}) {
 	key, err := cache.MetaNamespaceKeyFunc(obj)
 	if err != nil {
 		log.Printf("Error getting key for object: %v", err)
 		return
 	}
-	c.queue.Add(key)
+	namespace, _, err := cache.SplitMetaNamespaceKey(key)
+	if err != nil || !c.inScope(namespace) {
+		return
+	}
+	c.queue.Add(queueItem{source: source, key: key})
+}
+
+// publish writes the DNS record for hostname on behalf of owner. Records
+// published by a different resource are never overwritten, and invalid
+// hostnames or those outside the domain filter or the hostname policies of
+// the owner's namespace are refused. With a cluster name, the record is
+// merged with the endpoints of the other clusters.
+func (c *Controller) publish(hostname string, record *redisClient.DNSRecord, owner string) error {
+	if err := c.checkHostname(hostname); err != nil {
+		return err
+	}
+	if err := c.checkPolicy(ownerNamespace(owner), hostname); err != nil {
+		return err
+	}
+	if record.Metadata == nil {
+		record.Metadata = make(map[string]string)
+	}
+	record.Metadata["owner"] = owner
+
+	err := c.redis.UpdateRecord(context.TODO(), hostname, func(existing *redisClient.DNSRecord) (*redisClient.DNSRecord, error) {
+		if current := recordOwner(existing); current != "" && current != owner {
+			return nil, fmt.Errorf("%w: %s is published by %s", errConflict, hostname, current)
+		}
+		if c.cluster == "" {
+			return record, nil
+		}
+		return mergeRecord(record, existing, c.cluster, time.Now(), c.clusterExpiry), nil
+	})
+	if errors.Is(err, errConflict) {
+		return err
+	}
+	if err != nil {
+		return fmt.Errorf("error updating Redis record for %s: %w", hostname, redisError{err})
+	}
+
+	c.published.set(owner, hostname, len(record.IPs))
+	return nil
+}
+
+// unpublish removes the DNS record for hostname on behalf of owner. With a
+// cluster name, only the endpoints of this cluster are removed.
+func (c *Controller) unpublish(hostname, owner string) error {
+	err := c.redis.UpdateRecord(context.TODO(), hostname, func(existing *redisClient.DNSRecord) (*redisClient.DNSRecord, error) {
+		if current := recordOwner(existing); current != "" && current != owner {
+			return nil, fmt.Errorf("%w: %s is published by %s", errConflict, hostname, current)
+		}
+		if c.cluster == "" {
+			return nil, nil
+		}
+		return withdrawRecord(existing, c.cluster, time.Now(), c.clusterExpiry), nil
+	})
+	if err != nil {
+		return err
+	}
+
+	c.published.remove(owner, hostname)
+	return nil
+}
+
+// recordOwner returns the resource that published a record, if known
+func recordOwner(record *redisClient.DNSRecord) string {
+	if record == nil {
+		return ""
+	}
+	return record.Metadata["owner"]
+}
+
+// ownerKey identifies the resource publishing a record, e.g. service/default/web
+func ownerKey(source, namespace, name string) string {
+	return fmt.Sprintf("%s/%s/%s", source, namespace, name)
+}
+
+// Event handlers
+func (c *Controller) handleAdd(obj interface{}) {
+	c.enqueue(SourceService, obj)
 }
 
 func (c *Controller) handleUpdate(oldObj, newObj interface{}) {
@@ -170,22 +468,49 @@ func (c *Controller) handleDelete(obj interface{}) {
 	}
 
 	// Check if this service had our annotations
-	if enabled, ok := service.Annotations[annotationEnabled]; !ok || enabled != "true" {
+	annotations := c.annotations(service.Annotations)
+	if enabled, ok := annotations[annotationEnabled]; !ok || enabled != "true" {
 		return
 	}
 
-	hostname, ok := service.Annotations[annotationHostname]
-	if !ok || hostname == "" {
+	owner := ownerKey(SourceService, service.Namespace, service.Name)
+	hostnames := parseHostnames(annotations[annotationHostname])
+	for _, hostname := range hostnames {
+		c.deleteHostname(hostname, owner)
+	}
+	c.events.forget(owner)
+}
+
+// deleteHostname removes the DNS record for a hostname from Redis, along with
+// any per-pod records published under it. Records published by a resource
+// other than owner are left in place, and so are the endpoints of other
+// clusters.
+func (c *Controller) deleteHostname(hostname, owner string) {
+	record, err := c.redis.GetRecord(context.TODO(), hostname)
+	if err != nil {
+		klog.Errorf("Error fetching DNS record for %s: %v", hostname, err)
+		return
+	}
+	if current := recordOwner(record); current != "" && current != owner {
+		klog.Infof("Keeping DNS record for %s published by %s", hostname, current)
 		return
 	}
+	if record != nil {
+		for _, podHostname := range record.PodHostnames {
+			fqdn := podRecordName(podHostname, hostname)
+			if err := c.unpublish(fqdn, owner); err != nil {
+				klog.Errorf("Error deleting DNS record for %s: %v", fqdn, err)
+			}
+		}
+	}
 
 	// Delete the DNS record from Redis
-	if err := c.redis.DeleteRecord(context.TODO(), hostname); err != nil {
+	if err := c.unpublish(hostname, owner); err != nil {
 		klog.Errorf("Error deleting DNS record for %s: %v", hostname, err)
 		return
 	}
 
-	klog.Infof("Deleted DNS record for %s due to service deletion", hostname)
+	klog.Infof("Deleted DNS record for %s published by %s", hostname, owner)
 }
 
 // syncService processes a service and updates Redis DNS records
@@ -200,69 +525,253 @@ func (c *Controller) syncService(key string) error {
 	if err != nil {
 		return fmt.Errorf("error fetching service %s/%s: %v", namespace, name, err)
 	}
+	service.Annotations = c.annotations(service.Annotations)
 
 	// Check if service has our annotation
 	if enabled, ok := service.Annotations[annotationEnabled]; !ok || enabled != "true" {
 		return nil
 	}
 
-	hostname, ok := service.Annotations[annotationHostname]
-	if !ok || hostname == "" {
-		return fmt.Errorf("hostname annotation missing for service %s/%s", namespace, name)
+	status, err := c.publishService(service)
+	c.reportService(service, status, err)
+	return err
+}
+
+// publishService publishes the records of an annotated service, and returns
+// the hostnames published and the number of endpoints behind them
+func (c *Controller) publishService(service *corev1.Service) (serviceStatus, error) {
+	namespace, name := service.Namespace, service.Name
+	hostnames := parseHostnames(service.Annotations[annotationHostname])
+	if len(hostnames) == 0 {
+		return serviceStatus{}, fmt.Errorf("%w: hostname annotation missing for service %s/%s", errInvalidHostname, namespace, name)
+	}
+
+	// Get service endpoint slices
+	slices, err := c.client.DiscoveryV1().EndpointSlices(namespace).List(context.TODO(), metav1.ListOptions{
+		LabelSelector: fmt.Sprintf("%s=%s", discoveryv1.LabelServiceName, name),
+	})
+	if err != nil {
+		return serviceStatus{}, fmt.Errorf("error fetching endpoint slices for service %s/%s: %v", namespace, name, err)
 	}
 
-	// Get service endpoints
-	endpoints, err := c.client.CoreV1().Endpoints(namespace).Get(context.TODO(), name, metav1.GetOptions{})
+	ttl, err := recordTTL(service.Annotations)
 	if err != nil {
-		return fmt.Errorf("error fetching endpoints for service %s/%s: %v", namespace, name, err)
+		return serviceStatus{}, fmt.Errorf("%v for service %s/%s", err, namespace, name)
+	}
+	targetIPs, cname, err := parseTargets(service.Annotations[annotationTarget])
+	if err != nil {
+		return serviceStatus{}, fmt.Errorf("%v for service %s/%s", err, namespace, name)
 	}
 
-	// Collect pod IPs
-	var ips []string
-	for _, subset := range endpoints.Subsets {
-		for _, addr := range subset.Addresses {
-			ips = append(ips, addr.IP)
+	// Collect pod IPs, and for headless services the IPs behind each pod
+	// hostname, unless targets replace the addresses of the service
+	endpoints, podIPs := serviceAddresses(service, slices.Items)
+	if len(targetIPs) > 0 {
+		endpoints, podIPs = nil, nil
+		for _, ip := range targetIPs {
+			endpoints = append(endpoints, redisClient.Endpoint{IP: ip})
 		}
 	}
+	ips := endpointIPs(endpoints)
+
+	// Label the endpoints with their cluster, region and the weight of the
+	// service; endpoints of one service always share the same weight
+	weight := 0
+	if value, ok := service.Annotations[annotationWeight]; ok {
+		weight, err = strconv.Atoi(value)
+		if err != nil || weight < 1 {
+			return serviceStatus{}, fmt.Errorf("invalid weight %q for service %s/%s", value, namespace, name)
+		}
+	}
+	for i := range endpoints {
+		endpoints[i].Cluster = c.cluster
+		endpoints[i].Region = c.region
+		endpoints[i].Weight = weight
+	}
 
-	// Update Redis record
-	record := &redisClient.DNSRecord{
-		IPs:       ips,
-		TTL:       10, // TODO: Make configurable
-		UpdatedAt: time.Now(),
-		Metadata: map[string]string{
-			"namespace": namespace,
-			"service":   name,
-		},
+	policy, err := failoverPolicy(service)
+	if err != nil {
+		return serviceStatus{}, err
+	}
+	if policy != nil && c.cluster == "" {
+		// Without a cluster name endpoints belong to no cluster, so the
+		// primary could never be served
+		c.warnService(service, reasonFailoverIgnored, "Failover annotations are ignored without --cluster-name")
+		policy = nil
 	}
 
-	if err := c.redis.SetRecord(context.TODO(), hostname, record); err != nil {
-		return fmt.Errorf("error updating Redis record: %v", err)
+	owner := ownerKey(SourceService, namespace, name)
+	metadata := map[string]string{
+		"namespace": namespace,
+		"service":   name,
 	}
 
-	klog.Infof("Updated DNS record for %s with IPs: %v", hostname, ips)
-	return nil
+	if cname != "" {
+		for _, hostname := range hostnames {
+			record := &redisClient.DNSRecord{
+				TTL:       ttl,
+				UpdatedAt: time.Now(),
+				Metadata:  metadata,
+				Targets:   map[string][]string{"CNAME": {cname}},
+			}
+			if err := c.publish(hostname, record, owner); err != nil {
+				return serviceStatus{}, err
+			}
+			klog.Infof("Updated DNS record for %s with target %s", hostname, cname)
+		}
+		c.withdrawStale(owner, func(hostname string) bool { return containsString(hostnames, hostname) })
+		return serviceStatus{Hostnames: hostnames}, nil
+	}
+
+	if len(ips) == 0 {
+		if err := c.syncEmptyService(service, hostnames, owner, metadata); err != nil {
+			return serviceStatus{}, err
+		}
+		// The per-pod records under the hostnames are kept along with them
+		c.withdrawStale(owner, func(hostname string) bool { return inZones(hostname, hostnames) })
+		if emptyPolicy(service) == emptyPolicyDelete {
+			return serviceStatus{}, nil
+		}
+		return serviceStatus{Hostnames: hostnames}, nil
+	}
+
+	podHostnames := make([]string, 0, len(podIPs))
+	for podHostname := range podIPs {
+		podHostnames = append(podHostnames, podHostname)
+	}
+	sort.Strings(podHostnames)
+
+	current := make(map[string]bool)
+	for _, hostname := range hostnames {
+		// Per-pod records make no sense under a wildcard name
+		var published []string
+		if !isWildcard(hostname) {
+			published = podHostnames
+		}
+
+		// Publish a record per pod hostname so StatefulSet members stay addressable
+		for _, podHostname := range published {
+			podRecord := &redisClient.DNSRecord{
+				IPs:       podIPs[podHostname],
+				TTL:       ttl,
+				UpdatedAt: time.Now(),
+				Metadata:  metadata,
+			}
+
+			if err := c.publish(podRecordName(podHostname, hostname), podRecord, owner); err != nil {
+				return serviceStatus{}, err
+			}
+			current[podRecordName(podHostname, hostname)] = true
+		}
+
+		// Update Redis record
+		record := &redisClient.DNSRecord{
+			IPs:          ips,
+			TTL:          ttl,
+			UpdatedAt:    time.Now(),
+			Metadata:     metadata,
+			PodHostnames: published,
+			Endpoints:    endpoints,
+			Policy:       policy,
+		}
+		if txt := parseTXT(service.Annotations[annotationTXT]); len(txt) > 0 {
+			record.Targets = map[string][]string{"TXT": txt}
+		}
+
+		if err := c.publish(hostname, record, owner); err != nil {
+			return serviceStatus{}, err
+		}
+		current[hostname] = true
+
+		klog.Infof("Updated DNS record for %s with IPs: %v", hostname, ips)
+		if len(published) > 0 {
+			klog.Infof("Updated %d per-pod DNS records under %s", len(published), hostname)
+		}
+	}
+	c.withdrawStale(owner, func(hostname string) bool { return current[hostname] })
+	return serviceStatus{Hostnames: hostnames, Endpoints: len(endpoints)}, nil
 }
 
-// Add new method to reconcile all services
-func (c *Controller) reconcileAllServices() {
-	services, err := c.client.CoreV1().Services(metav1.NamespaceAll).List(context.TODO(), metav1.ListOptions{})
-	if err != nil {
-		klog.Errorf("Error listing services: %v", err)
-		return
+// withdrawStale removes the records owner published before but no longer
+// does, such as hostnames dropped from its annotation or the per-pod records
+// of removed pods, instead of leaving them until they expire. Only records
+// published since the controller started are known.
+func (c *Controller) withdrawStale(owner string, keep func(hostname string) bool) {
+	for _, hostname := range c.published.hostnames(owner) {
+		if keep(hostname) {
+			continue
+		}
+		if err := c.unpublish(hostname, owner); err != nil {
+			klog.Errorf("Error deleting DNS record for %s: %v", hostname, err)
+			continue
+		}
+		klog.Infof("Deleted DNS record for %s no longer published by %s", hostname, owner)
 	}
+}
 
-	for _, svc := range services.Items {
-		// Check if service has our annotation
-		if enabled, ok := svc.Annotations[annotationEnabled]; !ok || enabled != "true" {
+// parseHostnames splits the comma-separated hostname annotation into its
+// individual normalized hostnames, dropping empty entries
+func parseHostnames(value string) []string {
+	var hostnames []string
+	for _, hostname := range strings.Split(value, ",") {
+		hostname = normalizeHostname(hostname)
+		if hostname == "" {
 			continue
 		}
+		hostnames = append(hostnames, hostname)
+	}
+	return hostnames
+}
 
-		// Check if hostname annotation exists
-		if _, ok := svc.Annotations[annotationHostname]; !ok {
+// parseTXT splits the TXT annotation into one TXT string per line, dropping
+// empty lines
+func parseTXT(value string) []string {
+	var txt []string
+	for _, line := range strings.Split(value, "\n") {
+		line = strings.TrimSpace(line)
+		if line == "" {
 			continue
 		}
-		// Enqueue service for processing
-		c.queue.Add(fmt.Sprintf("%s/%s", svc.Namespace, svc.Name))
+		txt = append(txt, line)
+	}
+	return txt
+}
+
+// isWildcard reports whether a hostname is a wildcard such as *.apps.example.com
+func isWildcard(hostname string) bool {
+	return strings.HasPrefix(hostname, "*.")
+}
+
+// podRecordName returns the per-pod name published under a service hostname
+func podRecordName(podHostname, hostname string) string {
+	return fmt.Sprintf("%s.%s", podHostname, hostname)
+}
+
+// Add new method to reconcile all services
+func (c *Controller) reconcileAllServices() error {
+	for _, namespace := range c.watchedNamespaces() {
+		var options metav1.ListOptions
+		c.serviceListOptions(&options)
+		services, err := c.client.CoreV1().Services(namespace).List(context.TODO(), options)
+		if err != nil {
+			return fmt.Errorf("error listing services: %v", err)
+		}
+
+		for i := range services.Items {
+			svc := &services.Items[i]
+			annotations := c.annotations(svc.Annotations)
+			// Check if service has our annotation
+			if enabled, ok := annotations[annotationEnabled]; !ok || enabled != "true" {
+				continue
+			}
+
+			// Check if hostname annotation exists
+			if _, ok := annotations[annotationHostname]; !ok {
+				continue
+			}
+			// Enqueue service for processing
+			c.enqueue(SourceService, svc)
+		}
 	}
+	return nil
 }
@@ -2,9 +2,13 @@ package controller
 
 import (
 	"context"
+	"reflect"
+	"sort"
 	"testing"
 
+	"github.com/upstash/redis-external-dns/pkg/redis"
 	corev1 "k8s.io/api/core/v1"
+	discoveryv1 "k8s.io/api/discovery/v1"
 	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
 	"k8s.io/client-go/kubernetes/fake"
 )
@@ -29,24 +33,24 @@ func TestSyncService(t *testing.T) {
 		t.Fatalf("error creating service: %v", err)
 	}
 
-	// Create test endpoints
-	endpoints := &corev1.Endpoints{
+	// Create test endpoint slice
+	slice := &discoveryv1.EndpointSlice{
 		ObjectMeta: metav1.ObjectMeta{
-			Name:      "test-service",
+			Name:      "test-service-abc12",
 			Namespace: "default",
-		},
-		Subsets: []corev1.EndpointSubset{
-			{
-				Addresses: []corev1.EndpointAddress{
-					{IP: "192.168.1.1"},
-					{IP: "192.168.1.2"},
-				},
+			Labels: map[string]string{
+				discoveryv1.LabelServiceName: "test-service",
 			},
 		},
+		AddressType: discoveryv1.AddressTypeIPv4,
+		Endpoints: []discoveryv1.Endpoint{
+			{Addresses: []string{"192.168.1.1"}},
+			{Addresses: []string{"192.168.1.2"}},
+		},
 	}
-	_, err = client.CoreV1().Endpoints("default").Create(context.TODO(), endpoints, metav1.CreateOptions{})
+	_, err = client.DiscoveryV1().EndpointSlices("default").Create(context.TODO(), slice, metav1.CreateOptions{})
 	if err != nil {
-		t.Fatalf("error creating endpoints: %v", err)
+		t.Fatalf("error creating endpoint slice: %v", err)
 	}
 
 	// Create the controller
@@ -67,3 +71,148 @@ func TestSyncService(t *testing.T) {
 		t.Errorf("expected 2 IPs, got %d", len(record.IPs))
 	}
 }
+
+func TestParseHostnames(t *testing.T) {
+	tests := []struct {
+		value    string
+		expected []string
+	}{
+		{value: "", expected: nil},
+		{value: "a.example.com", expected: []string{"a.example.com"}},
+		{value: "a.example.com, b.example.com", expected: []string{"a.example.com", "b.example.com"}},
+		{value: "a.example.com,,*.apps.example.com,", expected: []string{"a.example.com", "*.apps.example.com"}},
+		{value: "A.Example.com., b.example.com.", expected: []string{"a.example.com", "b.example.com"}},
+	}
+
+	for _, tc := range tests {
+		got := parseHostnames(tc.value)
+		if !reflect.DeepEqual(got, tc.expected) {
+			t.Errorf("%q: expected %v, got %v", tc.value, tc.expected, got)
+		}
+	}
+}
+
+func TestParseTXT(t *testing.T) {
+	tests := []struct {
+		value    string
+		expected []string
+	}{
+		{value: "", expected: nil},
+		{value: "version=1.2.3", expected: []string{"version=1.2.3"}},
+		{value: "v=spf1 include:example.com ~all\nowner=team-a\n\n", expected: []string{"v=spf1 include:example.com ~all", "owner=team-a"}},
+	}
+
+	for _, tc := range tests {
+		got := parseTXT(tc.value)
+		if !reflect.DeepEqual(got, tc.expected) {
+			t.Errorf("%q: expected %v, got %v", tc.value, tc.expected, got)
+		}
+	}
+}
+
+// fakeRedis is an in-memory redis.Client for tests that do not need a real
+// Redis server
+type fakeRedis struct {
+	records map[string]*redis.DNSRecord
+	// pingErr is returned by Ping
+	pingErr error
+}
+
+func newFakeRedis() *fakeRedis {
+	return &fakeRedis{records: make(map[string]*redis.DNSRecord)}
+}
+
+func (f *fakeRedis) SetRecord(ctx context.Context, hostname string, record *redis.DNSRecord) error {
+	f.records[hostname] = record
+	return nil
+}
+
+func (f *fakeRedis) GetRecord(ctx context.Context, hostname string) (*redis.DNSRecord, error) {
+	return f.records[hostname], nil
+}
+
+func (f *fakeRedis) DeleteRecord(ctx context.Context, hostname string) error {
+	delete(f.records, hostname)
+	return nil
+}
+
+func (f *fakeRedis) UpdateRecord(ctx context.Context, hostname string, update redis.UpdateFunc) error {
+	record, err := update(f.records[hostname])
+	if err != nil {
+		return err
+	}
+	if record == nil {
+		delete(f.records, hostname)
+		return nil
+	}
+	f.records[hostname] = record
+	return nil
+}
+
+func (f *fakeRedis) Ping(ctx context.Context) error {
+	return f.pingErr
+}
+
+func (f *fakeRedis) MigrateKeys(ctx context.Context) (int, error) {
+	return 0, nil
+}
+
+func TestWithdrawDroppedHostnames(t *testing.T) {
+	svc := &corev1.Service{
+		ObjectMeta: metav1.ObjectMeta{
+			Name:      "db",
+			Namespace: "default",
+			Annotations: map[string]string{
+				annotationEnabled:  "true",
+				annotationHostname: "db.example.com,db.example.net",
+			},
+		},
+		Spec: corev1.ServiceSpec{ClusterIP: corev1.ClusterIPNone},
+	}
+	db0, db1 := "db-0", "db-1"
+	slice := &discoveryv1.EndpointSlice{
+		ObjectMeta: metav1.ObjectMeta{
+			Name:      "db-abc12",
+			Namespace: "default",
+			Labels:    map[string]string{discoveryv1.LabelServiceName: "db"},
+		},
+		AddressType: discoveryv1.AddressTypeIPv4,
+		Endpoints: []discoveryv1.Endpoint{
+			{Addresses: []string{"10.0.0.1"}, Hostname: &db0},
+			{Addresses: []string{"10.0.0.2"}, Hostname: &db1},
+		},
+	}
+	client := fake.NewSimpleClientset(svc, slice)
+	fakeRedis := newFakeRedis()
+	c := &Controller{client: client, redis: fakeRedis, published: newPublishedSet()}
+
+	if err := c.syncService("default/db"); err != nil {
+		t.Fatalf("syncService error: %v", err)
+	}
+	if _, ok := fakeRedis.records["db-1.db.example.net"]; !ok {
+		t.Fatal("expected a per-pod record for db-1")
+	}
+
+	// Drop a hostname and scale down to one pod
+	svc.Annotations[annotationHostname] = "db.example.com"
+	if _, err := client.CoreV1().Services("default").Update(context.TODO(), svc, metav1.UpdateOptions{}); err != nil {
+		t.Fatalf("error updating service: %v", err)
+	}
+	slice.Endpoints = slice.Endpoints[:1]
+	if _, err := client.DiscoveryV1().EndpointSlices("default").Update(context.TODO(), slice, metav1.UpdateOptions{}); err != nil {
+		t.Fatalf("error updating endpoint slice: %v", err)
+	}
+	if err := c.syncService("default/db"); err != nil {
+		t.Fatalf("syncService error: %v", err)
+	}
+
+	var hostnames []string
+	for hostname := range fakeRedis.records {
+		hostnames = append(hostnames, hostname)
+	}
+	sort.Strings(hostnames)
+	expected := []string{"db-0.db.example.com", "db.example.com"}
+	if !reflect.DeepEqual(hostnames, expected) {
+		t.Errorf("expected records %v, got %v", expected, hostnames)
+	}
+}
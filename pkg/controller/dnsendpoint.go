@@ -0,0 +1,216 @@
+package controller
+
+import (
+	"context"
+	"fmt"
+	"net"
+	"strings"
+	"time"
+
+	redisClient "github.com/upstash/redis-external-dns/pkg/redis"
+	apierrors "k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/apimachinery/pkg/runtime/schema"
+	"k8s.io/client-go/dynamic/dynamicinformer"
+	"k8s.io/client-go/tools/cache"
+	"k8s.io/klog/v2"
+)
+
+var dnsEndpointGVR = schema.GroupVersionResource{Group: "externaldns.k8s.io", Version: "v1alpha1", Resource: "dnsendpoints"}
+
+// dnsEndpointRecordTypes lists the record types published from DNSEndpoints
+var dnsEndpointRecordTypes = map[string]bool{
+	"A":     true,
+	"AAAA":  true,
+	"CNAME": true,
+	"TXT":   true,
+	"SRV":   true,
+}
+
+// dnsEndpoint holds the fields of an external-dns DNSEndpoint used to build records
+type dnsEndpoint struct {
+	Spec struct {
+		Endpoints []struct {
+			DNSName    string   `json:"dnsName"`
+			Targets    []string `json:"targets,omitempty"`
+			RecordType string   `json:"recordType,omitempty"`
+			RecordTTL  int64    `json:"recordTTL,omitempty"`
+		} `json:"endpoints,omitempty"`
+	} `json:"spec"`
+}
+
+// newDNSEndpointSource creates the source publishing the records declared by
+// DNSEndpoint resources. Unlike Services, DNSEndpoints need no annotation.
+func (c *Controller) newDNSEndpointSource() *source {
+	src := &source{
+		sync:      c.syncDNSEndpoint,
+		reconcile: c.reconcileAllDNSEndpoints,
+	}
+
+	for _, namespace := range c.watchedNamespaces() {
+		informer := dynamicinformer.NewFilteredDynamicInformer(c.dynamic, dnsEndpointGVR, namespace, 0, cache.Indexers{}, nil).Informer()
+		informer.AddEventHandler(cache.ResourceEventHandlerFuncs{
+			AddFunc: func(obj interface{}) {
+				c.enqueue(SourceDNSEndpoint, obj)
+			},
+			UpdateFunc: func(oldObj, newObj interface{}) {
+				c.enqueue(SourceDNSEndpoint, newObj)
+			},
+			DeleteFunc: c.handleDNSEndpointDelete,
+		})
+		src.informers = append(src.informers, informer)
+	}
+
+	return src
+}
+
+func (c *Controller) handleDNSEndpointDelete(obj interface{}) {
+	// Get the DNSEndpoint before it was deleted
+	if tombstone, ok := obj.(cache.DeletedFinalStateUnknown); ok {
+		obj = tombstone.Obj
+	}
+	endpoint, ok := obj.(*unstructured.Unstructured)
+	if !ok {
+		klog.Errorf("Error decoding object, invalid type")
+		return
+	}
+
+	records, err := dnsEndpointRecords(endpoint)
+	if err != nil {
+		klog.Errorf("Error decoding dnsendpoint %s/%s: %v", endpoint.GetNamespace(), endpoint.GetName(), err)
+		return
+	}
+
+	// The names published for an earlier version of the dnsendpoint are deleted too
+	owner := ownerKey(SourceDNSEndpoint, endpoint.GetNamespace(), endpoint.GetName())
+	hostnames := c.published.hostnames(owner)
+	for hostname := range records {
+		hostnames = appendUnique(hostnames, hostname)
+	}
+	for _, hostname := range hostnames {
+		c.deleteHostname(hostname, owner)
+	}
+}
+
+// syncDNSEndpoint processes a DNSEndpoint and updates Redis DNS records
+func (c *Controller) syncDNSEndpoint(key string) error {
+	namespace, name, err := cache.SplitMetaNamespaceKey(key)
+	if err != nil {
+		return fmt.Errorf("invalid resource key: %s", key)
+	}
+
+	owner := ownerKey(SourceDNSEndpoint, namespace, name)
+	endpoint, err := c.dynamic.Resource(dnsEndpointGVR).Namespace(namespace).Get(context.TODO(), name, metav1.GetOptions{})
+	if apierrors.IsNotFound(err) {
+		// Deleted since it was queued
+		c.withdrawStale(owner, func(string) bool { return false })
+		return nil
+	}
+	if err != nil {
+		return fmt.Errorf("error fetching dnsendpoint %s/%s: %v", namespace, name, err)
+	}
+
+	records, err := dnsEndpointRecords(endpoint)
+	if err != nil {
+		return err
+	}
+
+	for hostname, record := range records {
+		record.Metadata = map[string]string{
+			"namespace":   namespace,
+			"dnsendpoint": name,
+		}
+
+		if err := c.publish(hostname, record, owner); err != nil {
+			return err
+		}
+
+		klog.Infof("Updated DNS record for %s with IPs: %v, targets: %v", hostname, record.IPs, record.Targets)
+	}
+	// Withdraw the names removed from the endpoints
+	c.withdrawStale(owner, func(hostname string) bool {
+		_, ok := records[hostname]
+		return ok
+	})
+	return nil
+}
+
+// reconcileAllDNSEndpoints enqueues every DNSEndpoint for processing
+func (c *Controller) reconcileAllDNSEndpoints() error {
+	for _, namespace := range c.watchedNamespaces() {
+		endpoints, err := c.dynamic.Resource(dnsEndpointGVR).Namespace(namespace).List(context.TODO(), metav1.ListOptions{})
+		if err != nil {
+			return fmt.Errorf("error listing dnsendpoints: %v", err)
+		}
+
+		for i := range endpoints.Items {
+			c.enqueue(SourceDNSEndpoint, &endpoints.Items[i])
+		}
+	}
+	return nil
+}
+
+// dnsEndpointRecords groups the endpoints of a DNSEndpoint into one record
+// per name. A and AAAA targets become the record IPs; CNAME, TXT and SRV
+// targets are kept per record type.
+func dnsEndpointRecords(obj *unstructured.Unstructured) (map[string]*redisClient.DNSRecord, error) {
+	var endpoint dnsEndpoint
+	if err := runtime.DefaultUnstructuredConverter.FromUnstructured(obj.UnstructuredContent(), &endpoint); err != nil {
+		return nil, fmt.Errorf("error decoding dnsendpoint %s/%s: %v", obj.GetNamespace(), obj.GetName(), err)
+	}
+
+	records := make(map[string]*redisClient.DNSRecord)
+	for _, ep := range endpoint.Spec.Endpoints {
+		hostname := normalizeHostname(ep.DNSName)
+		if hostname == "" || len(ep.Targets) == 0 {
+			continue
+		}
+
+		recordType := strings.ToUpper(ep.RecordType)
+		if recordType == "" {
+			recordType = "A"
+		}
+		if !dnsEndpointRecordTypes[recordType] {
+			klog.Warningf("Skipping unsupported record type %s for %s in dnsendpoint %s/%s", recordType, hostname, obj.GetNamespace(), obj.GetName())
+			continue
+		}
+
+		record, ok := records[hostname]
+		if !ok {
+			record = &redisClient.DNSRecord{
+				TTL:       defaultRecordTTL,
+				UpdatedAt: time.Now(),
+			}
+			records[hostname] = record
+		}
+		if ep.RecordTTL > 0 {
+			record.TTL = int(ep.RecordTTL)
+		}
+
+		switch recordType {
+		case "A", "AAAA":
+			for _, target := range ep.Targets {
+				if net.ParseIP(target) == nil {
+					klog.Warningf("Skipping invalid %s target %q for %s in dnsendpoint %s/%s", recordType, target, hostname, obj.GetNamespace(), obj.GetName())
+					continue
+				}
+				record.IPs = appendUnique(record.IPs, target)
+			}
+		default:
+			if record.Targets == nil {
+				record.Targets = make(map[string][]string)
+			}
+			record.Targets[recordType] = appendUnique(record.Targets[recordType], ep.Targets...)
+		}
+	}
+
+	// Never publish empty records, such as names whose targets were all invalid
+	for hostname, record := range records {
+		if len(record.IPs) == 0 && len(record.Targets) == 0 {
+			delete(records, hostname)
+		}
+	}
+	return records, nil
+}
@@ -0,0 +1,122 @@
+package controller
+
+import (
+	"context"
+	"reflect"
+	"testing"
+
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+	"k8s.io/apimachinery/pkg/runtime"
+	dynamicfake "k8s.io/client-go/dynamic/fake"
+)
+
+func TestDNSEndpointRecords(t *testing.T) {
+	endpoint := &unstructured.Unstructured{Object: map[string]interface{}{
+		"apiVersion": "externaldns.k8s.io/v1alpha1",
+		"kind":       "DNSEndpoint",
+		"metadata": map[string]interface{}{
+			"name":      "records",
+			"namespace": "default",
+		},
+		"spec": map[string]interface{}{
+			"endpoints": []interface{}{
+				map[string]interface{}{"dnsName": "web.example.com", "recordType": "A", "targets": []interface{}{"192.168.1.1", "not-an-ip"}},
+				map[string]interface{}{"dnsName": "web.example.com.", "recordType": "AAAA", "targets": []interface{}{"2001:db8::1"}, "recordTTL": int64(60)},
+				map[string]interface{}{"dnsName": "web.example.com", "recordType": "TXT", "targets": []interface{}{"owner=team-a"}},
+				map[string]interface{}{"dnsName": "alias.example.com", "recordType": "CNAME", "targets": []interface{}{"web.example.com"}},
+				map[string]interface{}{"dnsName": "mail.example.com", "recordType": "MX", "targets": []interface{}{"10 mx.example.com"}},
+				map[string]interface{}{"dnsName": "empty.example.com", "recordType": "TXT"},
+				map[string]interface{}{"dnsName": "invalid.example.com", "recordType": "A", "targets": []interface{}{"not-an-ip"}},
+			},
+		},
+	}}
+
+	records, err := dnsEndpointRecords(endpoint)
+	if err != nil {
+		t.Fatalf("dnsEndpointRecords error: %v", err)
+	}
+
+	if len(records) != 2 {
+		t.Fatalf("expected 2 records, got %d", len(records))
+	}
+
+	web := records["web.example.com"]
+	if !reflect.DeepEqual(web.IPs, []string{"192.168.1.1", "2001:db8::1"}) {
+		t.Errorf("unexpected IPs for web.example.com: %v", web.IPs)
+	}
+	if web.TTL != 60 {
+		t.Errorf("expected TTL 60, got %d", web.TTL)
+	}
+	if !reflect.DeepEqual(web.Targets["TXT"], []string{"owner=team-a"}) {
+		t.Errorf("unexpected TXT targets for web.example.com: %v", web.Targets["TXT"])
+	}
+
+	alias := records["alias.example.com"]
+	if !reflect.DeepEqual(alias.Targets["CNAME"], []string{"web.example.com"}) {
+		t.Errorf("unexpected CNAME targets for alias.example.com: %v", alias.Targets["CNAME"])
+	}
+	if alias.TTL != defaultRecordTTL {
+		t.Errorf("expected the default TTL %d, got %d", defaultRecordTTL, alias.TTL)
+	}
+}
+
+func TestSyncDNSEndpointWithdrawsRemovedNames(t *testing.T) {
+	endpoint := &unstructured.Unstructured{Object: map[string]interface{}{
+		"apiVersion": "externaldns.k8s.io/v1alpha1",
+		"kind":       "DNSEndpoint",
+		"metadata": map[string]interface{}{
+			"name":      "records",
+			"namespace": "default",
+		},
+		"spec": map[string]interface{}{
+			"endpoints": []interface{}{
+				map[string]interface{}{"dnsName": "web.example.com", "targets": []interface{}{"192.168.1.1"}},
+				map[string]interface{}{"dnsName": "api.example.com", "targets": []interface{}{"192.168.1.2"}},
+			},
+		},
+	}}
+	fakeRedis := newFakeRedis()
+	c := &Controller{
+		dynamic:   dynamicfake.NewSimpleDynamicClient(runtime.NewScheme()),
+		redis:     fakeRedis,
+		published: newPublishedSet(),
+	}
+	endpoints := c.dynamic.Resource(dnsEndpointGVR).Namespace("default")
+	if _, err := endpoints.Create(context.TODO(), endpoint, metav1.CreateOptions{}); err != nil {
+		t.Fatalf("error creating dnsendpoint: %v", err)
+	}
+	if err := c.syncDNSEndpoint("default/records"); err != nil {
+		t.Fatalf("syncDNSEndpoint error: %v", err)
+	}
+	if len(fakeRedis.records) != 2 {
+		t.Fatalf("expected 2 records, got %v", fakeRedis.records)
+	}
+
+	// Removing an endpoint withdraws its name
+	spec := endpoint.Object["spec"].(map[string]interface{})
+	spec["endpoints"] = spec["endpoints"].([]interface{})[:1]
+	if _, err := endpoints.Update(context.TODO(), endpoint, metav1.UpdateOptions{}); err != nil {
+		t.Fatalf("error updating dnsendpoint: %v", err)
+	}
+	if err := c.syncDNSEndpoint("default/records"); err != nil {
+		t.Fatalf("syncDNSEndpoint error: %v", err)
+	}
+	if _, ok := fakeRedis.records["api.example.com"]; ok {
+		t.Error("expected api.example.com to be withdrawn")
+	}
+	if _, ok := fakeRedis.records["web.example.com"]; !ok {
+		t.Error("expected web.example.com to stay published")
+	}
+
+	// Deleting the dnsendpoint withdraws the rest
+	if err := endpoints.Delete(context.TODO(), "records", metav1.DeleteOptions{}); err != nil {
+		t.Fatalf("error deleting dnsendpoint: %v", err)
+	}
+	if err := c.syncDNSEndpoint("default/records"); err != nil {
+		t.Fatalf("syncDNSEndpoint error: %v", err)
+	}
+	if len(fakeRedis.records) != 0 {
+		t.Errorf("expected no records after deleting the dnsendpoint, got %v", fakeRedis.records)
+	}
+}
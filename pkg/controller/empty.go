@@ -0,0 +1,128 @@
+package controller
+
+import (
+	"context"
+	"fmt"
+	"time"
+
+	redisClient "github.com/upstash/redis-external-dns/pkg/redis"
+	corev1 "k8s.io/api/core/v1"
+	"k8s.io/klog/v2"
+)
+
+const (
+	// The annotation key selecting what happens to the records of a service
+	// without endpoints: delete, keep or fallback
+	annotationEmptyPolicy = "upstashternal-dns.alpha.kubernetes.io/empty-policy"
+	// The annotation key for how long the keep policy serves the last
+	// non-empty set of IPs
+	annotationEmptyGracePeriod = "upstashternal-dns.alpha.kubernetes.io/empty-grace-period"
+	// The annotation key for the hostname the fallback policy points to
+	annotationFallbackTarget = "upstashternal-dns.alpha.kubernetes.io/fallback-target"
+)
+
+// Policies for services without endpoints
+const (
+	emptyPolicyDelete   = "delete"
+	emptyPolicyKeep     = "keep"
+	emptyPolicyFallback = "fallback"
+)
+
+// defaultEmptyGracePeriod is how long the keep policy serves the last
+// non-empty IPs when no grace period is annotated
+const defaultEmptyGracePeriod = 5 * time.Minute
+
+// emptyPolicy returns the empty policy of a service, delete by default
+func emptyPolicy(service *corev1.Service) string {
+	if policy := service.Annotations[annotationEmptyPolicy]; policy != "" {
+		return policy
+	}
+	return emptyPolicyDelete
+}
+
+// syncEmptyService applies the empty policy of a service without endpoints to
+// each of its hostnames. Records with an empty set of IPs are never published.
+func (c *Controller) syncEmptyService(service *corev1.Service, hostnames []string, owner string, metadata map[string]string) error {
+	policy := emptyPolicy(service)
+	switch policy {
+	case emptyPolicyDelete:
+		for _, hostname := range hostnames {
+			c.deleteHostname(hostname, owner)
+		}
+		return nil
+
+	case emptyPolicyKeep:
+		gracePeriod := defaultEmptyGracePeriod
+		if value, ok := service.Annotations[annotationEmptyGracePeriod]; ok {
+			d, err := time.ParseDuration(value)
+			if err != nil {
+				return fmt.Errorf("invalid empty grace period %q for service %s/%s: %v", value, service.Namespace, service.Name, err)
+			}
+			gracePeriod = d
+		}
+
+		for _, hostname := range hostnames {
+			if err := c.keepRecord(hostname, owner, gracePeriod); err != nil {
+				return err
+			}
+		}
+		return nil
+
+	case emptyPolicyFallback:
+		target := service.Annotations[annotationFallbackTarget]
+		if target == "" {
+			return fmt.Errorf("fallback target annotation missing for service %s/%s", service.Namespace, service.Name)
+		}
+
+		ttl, err := recordTTL(service.Annotations)
+		if err != nil {
+			return fmt.Errorf("%v for service %s/%s", err, service.Namespace, service.Name)
+		}
+		for _, hostname := range hostnames {
+			record := &redisClient.DNSRecord{
+				TTL:       ttl,
+				UpdatedAt: time.Now(),
+				Metadata:  metadata,
+				Targets: map[string][]string{
+					"CNAME": {target},
+				},
+			}
+
+			if err := c.publish(hostname, record, owner); err != nil {
+				return err
+			}
+
+			klog.Infof("Service %s/%s has no endpoints, pointed %s to %s", service.Namespace, service.Name, hostname, target)
+		}
+		return nil
+	}
+
+	return fmt.Errorf("invalid empty policy %q for service %s/%s", policy, service.Namespace, service.Name)
+}
+
+// keepRecord keeps serving the last non-empty IPs published for hostname until
+// the grace period has passed since they were written, and deletes the record
+// afterwards. With a cluster name, only the endpoints of this cluster are kept.
+func (c *Controller) keepRecord(hostname, owner string, gracePeriod time.Duration) error {
+	record, err := c.redis.GetRecord(context.TODO(), hostname)
+	if err != nil {
+		return fmt.Errorf("error fetching Redis record for %s: %w", hostname, redisError{err})
+	}
+	if record != nil && c.cluster != "" {
+		record = clusterRecord(record, c.cluster)
+	}
+
+	if record == nil || len(record.IPs) == 0 || time.Since(record.UpdatedAt) >= gracePeriod {
+		c.deleteHostname(hostname, owner)
+		return nil
+	}
+
+	// Republish as is so the record does not expire, keeping UpdatedAt at the
+	// time the IPs were last seen
+	if err := c.publish(hostname, record, owner); err != nil {
+		return err
+	}
+
+	klog.Infof("Keeping last known IPs %v for %s until %s", record.IPs, hostname, record.UpdatedAt.Add(gracePeriod).Format(time.RFC3339))
+	return nil
+}
@@ -0,0 +1,77 @@
+package controller
+
+import (
+	"testing"
+	"time"
+
+	"github.com/upstash/redis-external-dns/pkg/redis"
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+)
+
+func TestSyncEmptyService(t *testing.T) {
+	owner := ownerKey(SourceService, "default", "web")
+
+	tests := []struct {
+		name        string
+		annotations map[string]string
+		existing    *redis.DNSRecord
+		expectIPs   []string
+		expectCNAME string
+		expectGone  bool
+	}{
+		{
+			name:       "delete by default",
+			existing:   &redis.DNSRecord{IPs: []string{"10.0.0.1"}, UpdatedAt: time.Now()},
+			expectGone: true,
+		},
+		{
+			name:        "keep within grace period",
+			annotations: map[string]string{annotationEmptyPolicy: emptyPolicyKeep, annotationEmptyGracePeriod: "1m"},
+			existing:    &redis.DNSRecord{IPs: []string{"10.0.0.1"}, UpdatedAt: time.Now()},
+			expectIPs:   []string{"10.0.0.1"},
+		},
+		{
+			name:        "keep expires after grace period",
+			annotations: map[string]string{annotationEmptyPolicy: emptyPolicyKeep, annotationEmptyGracePeriod: "1m"},
+			existing:    &redis.DNSRecord{IPs: []string{"10.0.0.1"}, UpdatedAt: time.Now().Add(-2 * time.Minute)},
+			expectGone:  true,
+		},
+		{
+			name:        "fallback target",
+			annotations: map[string]string{annotationEmptyPolicy: emptyPolicyFallback, annotationFallbackTarget: "web.other-cluster.example.com"},
+			existing:    &redis.DNSRecord{IPs: []string{"10.0.0.1"}, UpdatedAt: time.Now()},
+			expectCNAME: "web.other-cluster.example.com",
+		},
+	}
+
+	for _, tc := range tests {
+		fake := newFakeRedis()
+		fake.records["web.example.com"] = tc.existing
+		c := &Controller{redis: fake}
+
+		service := &corev1.Service{
+			ObjectMeta: metav1.ObjectMeta{Name: "web", Namespace: "default", Annotations: tc.annotations},
+		}
+		if err := c.syncEmptyService(service, []string{"web.example.com"}, owner, nil); err != nil {
+			t.Fatalf("%s: syncEmptyService error: %v", tc.name, err)
+		}
+
+		record := fake.records["web.example.com"]
+		if tc.expectGone {
+			if record != nil {
+				t.Errorf("%s: expected record to be deleted, got %+v", tc.name, record)
+			}
+			continue
+		}
+		if record == nil {
+			t.Fatalf("%s: expected record to exist", tc.name)
+		}
+		if len(record.IPs) != len(tc.expectIPs) {
+			t.Errorf("%s: expected IPs %v, got %v", tc.name, tc.expectIPs, record.IPs)
+		}
+		if tc.expectCNAME != "" && (len(record.Targets["CNAME"]) != 1 || record.Targets["CNAME"][0] != tc.expectCNAME) {
+			t.Errorf("%s: expected CNAME %s, got %v", tc.name, tc.expectCNAME, record.Targets["CNAME"])
+		}
+	}
+}
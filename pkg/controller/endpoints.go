@@ -0,0 +1,137 @@
+package controller
+
+import (
+	redisClient "github.com/upstash/redis-external-dns/pkg/redis"
+	corev1 "k8s.io/api/core/v1"
+	discoveryv1 "k8s.io/api/discovery/v1"
+	"k8s.io/apimachinery/pkg/util/validation"
+)
+
+const (
+	// The annotation key to keep publishing terminating endpoints that are
+	// still serving while a service has no ready endpoints
+	annotationPublishTerminating = "upstashternal-dns.alpha.kubernetes.io/publish-terminating"
+)
+
+// serviceAddresses returns the endpoints to publish for a service along with
+// their zone, node and topology hints, and for headless services the
+// addresses behind each pod hostname.
+//
+// Ready endpoints are always published. Services setting
+// publishNotReadyAddresses publish every endpoint regardless of its
+// conditions. Services annotated with publish-terminating fall back to
+// terminating endpoints that are still serving when no endpoint is ready, so
+// a rollout never leaves the name without addresses.
+func serviceAddresses(service *corev1.Service, slices []discoveryv1.EndpointSlice) ([]redisClient.Endpoint, map[string][]string) {
+	publishNotReady := service.Spec.PublishNotReadyAddresses
+	publishTerminating := service.Annotations[annotationPublishTerminating] == "true"
+
+	var ready, terminating []discoveryv1.Endpoint
+	for _, slice := range slices {
+		if slice.AddressType == discoveryv1.AddressTypeFQDN {
+			continue
+		}
+		for _, endpoint := range slice.Endpoints {
+			switch {
+			case publishNotReady || endpointReady(endpoint):
+				ready = append(ready, endpoint)
+			case publishTerminating && endpointServingTerminating(endpoint):
+				terminating = append(terminating, endpoint)
+			}
+		}
+	}
+
+	published := ready
+	if len(published) == 0 {
+		published = terminating
+	}
+
+	headless := service.Spec.ClusterIP == corev1.ClusterIPNone
+	seen := make(map[string]bool)
+	var endpoints []redisClient.Endpoint
+	podIPs := make(map[string][]string)
+	for _, endpoint := range published {
+		podHostname := ""
+		if headless {
+			podHostname = endpointHostname(endpoint)
+		}
+
+		for _, ip := range endpoint.Addresses {
+			// The same endpoint can briefly appear in two slices
+			if seen[ip] {
+				continue
+			}
+			seen[ip] = true
+
+			endpoints = append(endpoints, redisClient.Endpoint{
+				IP:    ip,
+				Zone:  stringValue(endpoint.Zone),
+				Node:  stringValue(endpoint.NodeName),
+				Hints: endpointHints(endpoint),
+			})
+			if podHostname != "" {
+				podIPs[podHostname] = append(podIPs[podHostname], ip)
+			}
+		}
+	}
+	return endpoints, podIPs
+}
+
+// endpointIPs returns the IPs of a list of endpoints
+func endpointIPs(endpoints []redisClient.Endpoint) []string {
+	ips := make([]string, 0, len(endpoints))
+	for _, endpoint := range endpoints {
+		ips = append(ips, endpoint.IP)
+	}
+	return ips
+}
+
+// endpointHints returns the zones an endpoint is hinted to serve
+func endpointHints(endpoint discoveryv1.Endpoint) []string {
+	if endpoint.Hints == nil {
+		return nil
+	}
+	var zones []string
+	for _, zone := range endpoint.Hints.ForZones {
+		zones = append(zones, zone.Name)
+	}
+	return zones
+}
+
+// stringValue dereferences an optional string
+func stringValue(value *string) string {
+	if value == nil {
+		return ""
+	}
+	return *value
+}
+
+// endpointReady reports whether an endpoint is ready. A missing condition
+// means the endpoint is ready.
+func endpointReady(endpoint discoveryv1.Endpoint) bool {
+	return endpoint.Conditions.Ready == nil || *endpoint.Conditions.Ready
+}
+
+// endpointServingTerminating reports whether an endpoint is terminating but
+// still able to serve traffic
+func endpointServingTerminating(endpoint discoveryv1.Endpoint) bool {
+	serving := endpoint.Conditions.Serving != nil && *endpoint.Conditions.Serving
+	terminating := endpoint.Conditions.Terminating != nil && *endpoint.Conditions.Terminating
+	return serving && terminating
+}
+
+// endpointHostname returns the DNS label identifying the pod behind an
+// endpoint. StatefulSet pods carry an explicit hostname; otherwise the name of
+// the referenced pod is used when it is a valid DNS label.
+func endpointHostname(endpoint discoveryv1.Endpoint) string {
+	if endpoint.Hostname != nil && *endpoint.Hostname != "" {
+		return *endpoint.Hostname
+	}
+	if endpoint.TargetRef == nil || endpoint.TargetRef.Kind != "Pod" {
+		return ""
+	}
+	if errs := validation.IsDNS1123Label(endpoint.TargetRef.Name); len(errs) > 0 {
+		return ""
+	}
+	return endpoint.TargetRef.Name
+}
@@ -0,0 +1,168 @@
+package controller
+
+import (
+	"reflect"
+	"testing"
+
+	"github.com/upstash/redis-external-dns/pkg/redis"
+	corev1 "k8s.io/api/core/v1"
+	discoveryv1 "k8s.io/api/discovery/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+)
+
+func TestServiceAddresses(t *testing.T) {
+	yes, no := true, false
+	web0, web1 := "web-0", "web-1"
+
+	slices := []discoveryv1.EndpointSlice{
+		{
+			AddressType: discoveryv1.AddressTypeIPv4,
+			Endpoints: []discoveryv1.Endpoint{
+				{Addresses: []string{"10.0.0.1"}, Hostname: &web0},
+				{Addresses: []string{"10.0.0.2"}, Hostname: &web1, Conditions: discoveryv1.EndpointConditions{Ready: &no}},
+				{Addresses: []string{"10.0.0.3"}, Conditions: discoveryv1.EndpointConditions{Ready: &no, Serving: &yes, Terminating: &yes}},
+			},
+		},
+	}
+
+	tests := []struct {
+		name        string
+		service     *corev1.Service
+		slices      []discoveryv1.EndpointSlice
+		expectedIPs []string
+		expectedPod map[string][]string
+	}{
+		{
+			name:        "ready endpoints only",
+			service:     &corev1.Service{},
+			slices:      slices,
+			expectedIPs: []string{"10.0.0.1"},
+			expectedPod: map[string][]string{},
+		},
+		{
+			name: "headless publishes pod hostnames",
+			service: &corev1.Service{
+				Spec: corev1.ServiceSpec{ClusterIP: corev1.ClusterIPNone},
+			},
+			slices:      slices,
+			expectedIPs: []string{"10.0.0.1"},
+			expectedPod: map[string][]string{"web-0": {"10.0.0.1"}},
+		},
+		{
+			name: "publish not ready addresses",
+			service: &corev1.Service{
+				Spec: corev1.ServiceSpec{PublishNotReadyAddresses: true},
+			},
+			slices:      slices,
+			expectedIPs: []string{"10.0.0.1", "10.0.0.2", "10.0.0.3"},
+			expectedPod: map[string][]string{},
+		},
+		{
+			name: "terminating endpoints are a fallback",
+			service: &corev1.Service{
+				ObjectMeta: metav1.ObjectMeta{
+					Annotations: map[string]string{annotationPublishTerminating: "true"},
+				},
+			},
+			slices: []discoveryv1.EndpointSlice{
+				{
+					AddressType: discoveryv1.AddressTypeIPv4,
+					Endpoints:   slices[0].Endpoints[1:],
+				},
+			},
+			expectedIPs: []string{"10.0.0.3"},
+			expectedPod: map[string][]string{},
+		},
+		{
+			name: "terminating endpoints unused while ready endpoints exist",
+			service: &corev1.Service{
+				ObjectMeta: metav1.ObjectMeta{
+					Annotations: map[string]string{annotationPublishTerminating: "true"},
+				},
+			},
+			slices:      slices,
+			expectedIPs: []string{"10.0.0.1"},
+			expectedPod: map[string][]string{},
+		},
+	}
+
+	for _, tc := range tests {
+		endpoints, podIPs := serviceAddresses(tc.service, tc.slices)
+		if ips := endpointIPs(endpoints); !reflect.DeepEqual(ips, tc.expectedIPs) {
+			t.Errorf("%s: expected IPs %v, got %v", tc.name, tc.expectedIPs, ips)
+		}
+		if !reflect.DeepEqual(podIPs, tc.expectedPod) {
+			t.Errorf("%s: expected pod IPs %v, got %v", tc.name, tc.expectedPod, podIPs)
+		}
+	}
+}
+
+func TestServiceAddressesTopology(t *testing.T) {
+	zone, node := "us-east-1a", "node-1"
+	slices := []discoveryv1.EndpointSlice{
+		{
+			AddressType: discoveryv1.AddressTypeIPv4,
+			Endpoints: []discoveryv1.Endpoint{
+				{
+					Addresses: []string{"10.0.0.1"},
+					Zone:      &zone,
+					NodeName:  &node,
+					Hints: &discoveryv1.EndpointHints{
+						ForZones: []discoveryv1.ForZone{{Name: "us-east-1a"}, {Name: "us-east-1b"}},
+					},
+				},
+			},
+		},
+	}
+
+	endpoints, _ := serviceAddresses(&corev1.Service{}, slices)
+	expected := []redis.Endpoint{
+		{IP: "10.0.0.1", Zone: "us-east-1a", Node: "node-1", Hints: []string{"us-east-1a", "us-east-1b"}},
+	}
+	if !reflect.DeepEqual(endpoints, expected) {
+		t.Errorf("expected %+v, got %+v", expected, endpoints)
+	}
+}
+
+func TestEndpointHostname(t *testing.T) {
+	hostname := "web-0"
+
+	tests := []struct {
+		name     string
+		endpoint discoveryv1.Endpoint
+		expected string
+	}{
+		{
+			name:     "statefulset hostname",
+			endpoint: discoveryv1.Endpoint{Addresses: []string{"10.0.0.1"}, Hostname: &hostname},
+			expected: "web-0",
+		},
+		{
+			name: "pod target ref",
+			endpoint: discoveryv1.Endpoint{
+				Addresses: []string{"10.0.0.2"},
+				TargetRef: &corev1.ObjectReference{Kind: "Pod", Name: "web-1"},
+			},
+			expected: "web-1",
+		},
+		{
+			name: "non-pod target ref",
+			endpoint: discoveryv1.Endpoint{
+				Addresses: []string{"10.0.0.3"},
+				TargetRef: &corev1.ObjectReference{Kind: "Node", Name: "node-1"},
+			},
+			expected: "",
+		},
+		{
+			name:     "no identity",
+			endpoint: discoveryv1.Endpoint{Addresses: []string{"10.0.0.4"}},
+			expected: "",
+		},
+	}
+
+	for _, tc := range tests {
+		if got := endpointHostname(tc.endpoint); got != tc.expected {
+			t.Errorf("%s: expected %q, got %q", tc.name, tc.expected, got)
+		}
+	}
+}
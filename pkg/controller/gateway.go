@@ -0,0 +1,475 @@
+package controller
+
+import (
+	"context"
+	"fmt"
+	"sort"
+	"strings"
+	"time"
+
+	redisClient "github.com/upstash/redis-external-dns/pkg/redis"
+	apierrors "k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+	"k8s.io/apimachinery/pkg/labels"
+	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/apimachinery/pkg/runtime/schema"
+	"k8s.io/client-go/dynamic/dynamicinformer"
+	"k8s.io/client-go/tools/cache"
+	"k8s.io/klog/v2"
+)
+
+var (
+	gatewayGVR = schema.GroupVersionResource{Group: "gateway.networking.k8s.io", Version: "v1", Resource: "gateways"}
+
+	// gatewayRouteGVRs maps each Gateway API source to the route resource it watches
+	gatewayRouteGVRs = map[string]schema.GroupVersionResource{
+		SourceGatewayHTTPRoute: {Group: "gateway.networking.k8s.io", Version: "v1", Resource: "httproutes"},
+		SourceGatewayGRPCRoute: {Group: "gateway.networking.k8s.io", Version: "v1", Resource: "grpcroutes"},
+		SourceGatewayTLSRoute:  {Group: "gateway.networking.k8s.io", Version: "v1alpha2", Resource: "tlsroutes"},
+	}
+)
+
+// gatewayRoute holds the fields of an HTTPRoute, GRPCRoute or TLSRoute used
+// to derive hostnames
+type gatewayRoute struct {
+	Spec struct {
+		Hostnames  []string           `json:"hostnames,omitempty"`
+		ParentRefs []gatewayParentRef `json:"parentRefs,omitempty"`
+	} `json:"spec"`
+	Status struct {
+		Parents []struct {
+			ParentRef  gatewayParentRef `json:"parentRef"`
+			Conditions []struct {
+				Type   string `json:"type"`
+				Status string `json:"status"`
+			} `json:"conditions,omitempty"`
+		} `json:"parents,omitempty"`
+	} `json:"status"`
+}
+
+// gatewayParentRef references the Gateway, and optionally the listener, a
+// route is attached to
+type gatewayParentRef struct {
+	Group       string `json:"group,omitempty"`
+	Kind        string `json:"kind,omitempty"`
+	Namespace   string `json:"namespace,omitempty"`
+	Name        string `json:"name"`
+	SectionName string `json:"sectionName,omitempty"`
+}
+
+// gateway holds the fields of a Gateway used to derive hostnames and addresses
+type gateway struct {
+	Spec struct {
+		Listeners []struct {
+			Name          string `json:"name"`
+			Hostname      string `json:"hostname,omitempty"`
+			AllowedRoutes struct {
+				Namespaces struct {
+					From     string                `json:"from,omitempty"`
+					Selector *metav1.LabelSelector `json:"selector,omitempty"`
+				} `json:"namespaces"`
+			} `json:"allowedRoutes"`
+		} `json:"listeners"`
+	} `json:"spec"`
+	Status struct {
+		Addresses []struct {
+			Type  string `json:"type,omitempty"`
+			Value string `json:"value"`
+		} `json:"addresses,omitempty"`
+	} `json:"status"`
+}
+
+// newGatewayRouteSource creates the source publishing records for annotated
+// Gateway API routes of the given kind
+func (c *Controller) newGatewayRouteSource(name string) *source {
+	gvr := gatewayRouteGVRs[name]
+	src := &source{
+		sync: func(key string) error {
+			return c.syncGatewayRoute(name, key)
+		},
+		reconcile: func() error {
+			return c.reconcileAllGatewayRoutes(name)
+		},
+	}
+
+	for _, namespace := range c.watchedNamespaces() {
+		informer := dynamicinformer.NewFilteredDynamicInformer(c.dynamic, gvr, namespace, 0, cache.Indexers{}, nil).Informer()
+		informer.AddEventHandler(cache.ResourceEventHandlerFuncs{
+			AddFunc: func(obj interface{}) {
+				c.enqueue(name, obj)
+			},
+			UpdateFunc: func(oldObj, newObj interface{}) {
+				c.enqueue(name, newObj)
+			},
+			DeleteFunc: func(obj interface{}) {
+				c.handleGatewayRouteDelete(name, obj)
+			},
+		})
+		src.informers = append(src.informers, informer)
+	}
+
+	// Routes are resynced whenever the Gateway they are attached to changes
+	if c.gatewayInformers == nil {
+		for _, namespace := range c.watchedNamespaces() {
+			informer := dynamicinformer.NewFilteredDynamicInformer(c.dynamic, gatewayGVR, namespace, 0, cache.Indexers{}, nil).Informer()
+			informer.AddEventHandler(cache.ResourceEventHandlerFuncs{
+				AddFunc: c.handleGateway,
+				UpdateFunc: func(oldObj, newObj interface{}) {
+					c.handleGateway(newObj)
+				},
+				DeleteFunc: c.handleGateway,
+			})
+			c.gatewayInformers = append(c.gatewayInformers, informer)
+		}
+		c.informers = append(c.informers, c.gatewayInformers...)
+	}
+
+	return src
+}
+
+// handleGateway enqueues every route attached to a changed Gateway
+func (c *Controller) handleGateway(obj interface{}) {
+	if tombstone, ok := obj.(cache.DeletedFinalStateUnknown); ok {
+		obj = tombstone.Obj
+	}
+	gw, ok := obj.(*unstructured.Unstructured)
+	if !ok {
+		klog.Errorf("Error decoding object, invalid type")
+		return
+	}
+
+	for name, src := range c.sources {
+		if _, ok := gatewayRouteGVRs[name]; !ok {
+			continue
+		}
+		for _, informer := range src.informers {
+			for _, item := range informer.GetStore().List() {
+				route, ok := item.(*unstructured.Unstructured)
+				if !ok {
+					continue
+				}
+				for _, ref := range routeParentRefs(route) {
+					if gatewayRefNamespace(ref, route) == gw.GetNamespace() && ref.Name == gw.GetName() {
+						c.enqueue(name, route)
+						break
+					}
+				}
+			}
+		}
+	}
+}
+
+func (c *Controller) handleGatewayRouteDelete(name string, obj interface{}) {
+	// Get the route before it was deleted
+	if tombstone, ok := obj.(cache.DeletedFinalStateUnknown); ok {
+		obj = tombstone.Obj
+	}
+	route, ok := obj.(*unstructured.Unstructured)
+	if !ok {
+		klog.Errorf("Error decoding object, invalid type")
+		return
+	}
+
+	if enabled, ok := c.annotations(route.GetAnnotations())[annotationEnabled]; !ok || enabled != "true" {
+		return
+	}
+
+	// The hostnames published for the route may no longer resolve through its
+	// Gateways, so those known to be published and those of the route are
+	// deleted too; records of other resources are left in place
+	owner := ownerKey(name, route.GetNamespace(), route.GetName())
+	hostnames := appendUnique(c.published.hostnames(owner), routeHostnames(route)...)
+	records, err := c.gatewayRouteRecords(route)
+	if err != nil {
+		klog.Errorf("Error resolving hostnames for %s %s/%s: %v", name, route.GetNamespace(), route.GetName(), err)
+	}
+	for hostname := range records {
+		hostnames = appendUnique(hostnames, hostname)
+	}
+	for _, hostname := range hostnames {
+		c.deleteHostname(hostname, owner)
+	}
+}
+
+// syncGatewayRoute processes a Gateway API route and updates Redis DNS records
+func (c *Controller) syncGatewayRoute(name, key string) error {
+	namespace, routeName, err := cache.SplitMetaNamespaceKey(key)
+	if err != nil {
+		return fmt.Errorf("invalid resource key: %s", key)
+	}
+
+	route, err := c.dynamic.Resource(gatewayRouteGVRs[name]).Namespace(namespace).Get(context.TODO(), routeName, metav1.GetOptions{})
+	if err != nil {
+		return fmt.Errorf("error fetching %s %s/%s: %v", name, namespace, routeName, err)
+	}
+
+	// Check if route has our annotation
+	if enabled, ok := c.annotations(route.GetAnnotations())[annotationEnabled]; !ok || enabled != "true" {
+		return nil
+	}
+
+	owner := ownerKey(name, namespace, routeName)
+	records, err := c.gatewayRouteRecords(route)
+	if err != nil {
+		return err
+	}
+	if len(records) == 0 {
+		// Such as when its Gateways were deleted
+		klog.Infof("No hostnames found for %s %s/%s", name, namespace, routeName)
+		c.withdrawStale(owner, func(string) bool { return false })
+		return nil
+	}
+
+	ttl, err := recordTTL(c.annotations(route.GetAnnotations()))
+	if err != nil {
+		return fmt.Errorf("%v for %s %s/%s", err, name, namespace, routeName)
+	}
+
+	for hostname, ips := range records {
+		record := &redisClient.DNSRecord{
+			IPs:       ips,
+			TTL:       ttl,
+			UpdatedAt: time.Now(),
+			Metadata: map[string]string{
+				"namespace": namespace,
+				"route":     routeName,
+			},
+		}
+
+		if err := c.publish(hostname, record, owner); err != nil {
+			return err
+		}
+
+		klog.Infof("Updated DNS record for %s with IPs: %v", hostname, ips)
+	}
+	c.withdrawStale(owner, func(hostname string) bool { _, ok := records[hostname]; return ok })
+	return nil
+}
+
+// reconcileAllGatewayRoutes enqueues every annotated route of a kind for processing
+func (c *Controller) reconcileAllGatewayRoutes(name string) error {
+	for _, namespace := range c.watchedNamespaces() {
+		routes, err := c.dynamic.Resource(gatewayRouteGVRs[name]).Namespace(namespace).List(context.TODO(), metav1.ListOptions{})
+		if err != nil {
+			return fmt.Errorf("error listing %s: %v", name, err)
+		}
+
+		for i := range routes.Items {
+			route := &routes.Items[i]
+			if enabled, ok := c.annotations(route.GetAnnotations())[annotationEnabled]; !ok || enabled != "true" {
+				continue
+			}
+			c.enqueue(name, route)
+		}
+	}
+	return nil
+}
+
+// gatewayRouteRecords returns the IPs to publish for each hostname of a route.
+// Route hostnames are intersected with the hostnames of the listeners the
+// route is attached to, and resolve to the addresses of the parent Gateway.
+// Gateways that do not exist or have not accepted the route, and listeners
+// that do not allow routes from its namespace, contribute no hostnames.
+func (c *Controller) gatewayRouteRecords(route *unstructured.Unstructured) (map[string][]string, error) {
+	var r gatewayRoute
+	if err := runtime.DefaultUnstructuredConverter.FromUnstructured(route.UnstructuredContent(), &r); err != nil {
+		return nil, fmt.Errorf("error decoding route %s/%s: %v", route.GetNamespace(), route.GetName(), err)
+	}
+
+	hostnames := r.Spec.Hostnames
+	if len(hostnames) == 0 {
+		// Routes without hostnames inherit the listener hostname
+		hostnames = []string{""}
+	}
+
+	records := make(map[string][]string)
+	for _, ref := range r.Spec.ParentRefs {
+		if (ref.Group != "" && ref.Group != gatewayGVR.Group) || (ref.Kind != "" && ref.Kind != "Gateway") {
+			continue
+		}
+		if !r.accepted(ref, route.GetNamespace()) {
+			klog.V(2).Infof("Skipping gateway %s/%s that has not accepted route %s/%s", gatewayRefNamespace(ref, route), ref.Name, route.GetNamespace(), route.GetName())
+			continue
+		}
+
+		namespace := gatewayRefNamespace(ref, route)
+		obj, err := c.dynamic.Resource(gatewayGVR).Namespace(namespace).Get(context.TODO(), ref.Name, metav1.GetOptions{})
+		if apierrors.IsNotFound(err) {
+			klog.V(2).Infof("Skipping missing gateway %s/%s of route %s/%s", namespace, ref.Name, route.GetNamespace(), route.GetName())
+			continue
+		}
+		if err != nil {
+			return nil, fmt.Errorf("error fetching gateway %s/%s: %v", namespace, ref.Name, err)
+		}
+
+		var gw gateway
+		if err := runtime.DefaultUnstructuredConverter.FromUnstructured(obj.UnstructuredContent(), &gw); err != nil {
+			return nil, fmt.Errorf("error decoding gateway %s/%s: %v", namespace, ref.Name, err)
+		}
+
+		var ips []string
+		for _, addr := range gw.Status.Addresses {
+			if addr.Type != "" && addr.Type != "IPAddress" {
+				klog.V(2).Infof("Skipping %s address %s for gateway %s/%s", addr.Type, addr.Value, namespace, ref.Name)
+				continue
+			}
+			ips = append(ips, addr.Value)
+		}
+
+		for _, listener := range gw.Spec.Listeners {
+			if ref.SectionName != "" && listener.Name != ref.SectionName {
+				continue
+			}
+			allowed, err := c.listenerAllows(listener.AllowedRoutes.Namespaces.From, listener.AllowedRoutes.Namespaces.Selector, namespace, route.GetNamespace())
+			if err != nil {
+				return nil, fmt.Errorf("error checking routes allowed by gateway %s/%s: %v", namespace, ref.Name, err)
+			}
+			if !allowed {
+				continue
+			}
+			for _, routeHostname := range hostnames {
+				hostname, ok := gatewayHostname(listener.Hostname, routeHostname)
+				if !ok {
+					continue
+				}
+				records[hostname] = appendUnique(records[hostname], ips...)
+			}
+		}
+	}
+
+	for hostname := range records {
+		sort.Strings(records[hostname])
+	}
+	return records, nil
+}
+
+// accepted reports whether the Gateway referenced by ref has accepted the
+// route, as recorded in the route status by the Gateway implementation
+func (r *gatewayRoute) accepted(ref gatewayParentRef, namespace string) bool {
+	refNamespace := ref.Namespace
+	if refNamespace == "" {
+		refNamespace = namespace
+	}
+	for _, parent := range r.Status.Parents {
+		parentNamespace := parent.ParentRef.Namespace
+		if parentNamespace == "" {
+			parentNamespace = namespace
+		}
+		if parent.ParentRef.Name != ref.Name || parentNamespace != refNamespace || parent.ParentRef.SectionName != ref.SectionName {
+			continue
+		}
+		for _, condition := range parent.Conditions {
+			if condition.Type == "Accepted" {
+				return condition.Status == string(metav1.ConditionTrue)
+			}
+		}
+	}
+	return false
+}
+
+// listenerAllows reports whether a listener of a Gateway in gatewayNamespace
+// allows routes from routeNamespace. Listeners allow routes from the same
+// namespace by default.
+func (c *Controller) listenerAllows(from string, selector *metav1.LabelSelector, gatewayNamespace, routeNamespace string) (bool, error) {
+	switch from {
+	case "", "Same":
+		return routeNamespace == gatewayNamespace, nil
+	case "All":
+		return true, nil
+	case "Selector":
+		if selector == nil {
+			return false, nil
+		}
+		s, err := metav1.LabelSelectorAsSelector(selector)
+		if err != nil {
+			return false, fmt.Errorf("invalid namespace selector: %v", err)
+		}
+		ns, err := c.client.CoreV1().Namespaces().Get(context.TODO(), routeNamespace, metav1.GetOptions{})
+		if err != nil {
+			return false, fmt.Errorf("error fetching namespace %s: %v", routeNamespace, err)
+		}
+		return s.Matches(labels.Set(ns.GetLabels())), nil
+	}
+	return false, nil
+}
+
+// routeHostnames returns the normalized hostnames in the spec of a route,
+// ignoring decoding errors
+func routeHostnames(route *unstructured.Unstructured) []string {
+	var r gatewayRoute
+	if err := runtime.DefaultUnstructuredConverter.FromUnstructured(route.UnstructuredContent(), &r); err != nil {
+		return nil
+	}
+	var hostnames []string
+	for _, hostname := range r.Spec.Hostnames {
+		if hostname = normalizeHostname(hostname); hostname != "" {
+			hostnames = appendUnique(hostnames, hostname)
+		}
+	}
+	return hostnames
+}
+
+// routeParentRefs returns the parent references of a route, ignoring decoding errors
+func routeParentRefs(route *unstructured.Unstructured) []gatewayParentRef {
+	var r gatewayRoute
+	if err := runtime.DefaultUnstructuredConverter.FromUnstructured(route.UnstructuredContent(), &r); err != nil {
+		return nil
+	}
+	return r.Spec.ParentRefs
+}
+
+// gatewayRefNamespace returns the namespace of the Gateway a parent reference
+// points to, which defaults to the namespace of the route
+func gatewayRefNamespace(ref gatewayParentRef, route *unstructured.Unstructured) string {
+	if ref.Namespace != "" {
+		return ref.Namespace
+	}
+	return route.GetNamespace()
+}
+
+// gatewayHostname returns the hostname published for a route hostname attached
+// to a listener, following the Gateway API hostname intersection rules. An
+// empty hostname on either side matches everything.
+func gatewayHostname(listener, route string) (string, bool) {
+	switch {
+	case listener == "":
+		return route, route != ""
+	case route == "":
+		return listener, true
+	case listener == route:
+		return route, true
+	case wildcardMatches(listener, route):
+		return route, true
+	case wildcardMatches(route, listener):
+		return listener, true
+	}
+	return "", false
+}
+
+// wildcardMatches reports whether the wildcard pattern covers hostname, which
+// may itself be a more specific wildcard
+func wildcardMatches(pattern, hostname string) bool {
+	if !isWildcard(pattern) {
+		return false
+	}
+	suffix := strings.TrimPrefix(pattern, "*")
+	return len(hostname) > len(suffix) && strings.HasSuffix(hostname, suffix)
+}
+
+// appendUnique appends the values not already present in list
+func appendUnique(list []string, values ...string) []string {
+	for _, value := range values {
+		found := false
+		for _, existing := range list {
+			if existing == value {
+				found = true
+				break
+			}
+		}
+		if !found {
+			list = append(list, value)
+		}
+	}
+	return list
+}
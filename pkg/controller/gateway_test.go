@@ -0,0 +1,228 @@
+package controller
+
+import (
+	"context"
+	"reflect"
+	"testing"
+
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+	"k8s.io/apimachinery/pkg/runtime"
+	dynamicfake "k8s.io/client-go/dynamic/fake"
+)
+
+func TestGatewayHostname(t *testing.T) {
+	tests := []struct {
+		listener string
+		route    string
+		expected string
+		ok       bool
+	}{
+		{listener: "", route: "a.example.com", expected: "a.example.com", ok: true},
+		{listener: "a.example.com", route: "", expected: "a.example.com", ok: true},
+		{listener: "", route: "", ok: false},
+		{listener: "a.example.com", route: "a.example.com", expected: "a.example.com", ok: true},
+		{listener: "*.example.com", route: "a.example.com", expected: "a.example.com", ok: true},
+		{listener: "a.example.com", route: "*.example.com", expected: "a.example.com", ok: true},
+		{listener: "*.example.com", route: "*.a.example.com", expected: "*.a.example.com", ok: true},
+		{listener: "*.example.com", route: "example.com", ok: false},
+		{listener: "a.example.com", route: "b.example.com", ok: false},
+	}
+
+	for _, tc := range tests {
+		got, ok := gatewayHostname(tc.listener, tc.route)
+		if got != tc.expected || ok != tc.ok {
+			t.Errorf("listener %q, route %q: expected (%q, %v), got (%q, %v)", tc.listener, tc.route, tc.expected, tc.ok, got, ok)
+		}
+	}
+}
+
+func TestGatewayRouteRecords(t *testing.T) {
+	gw := &unstructured.Unstructured{Object: map[string]interface{}{
+		"apiVersion": "gateway.networking.k8s.io/v1",
+		"kind":       "Gateway",
+		"metadata": map[string]interface{}{
+			"name":      "public",
+			"namespace": "infra",
+		},
+		"spec": map[string]interface{}{
+			"listeners": []interface{}{
+				map[string]interface{}{
+					"name":          "https",
+					"hostname":      "*.example.com",
+					"allowedRoutes": map[string]interface{}{"namespaces": map[string]interface{}{"from": "All"}},
+				},
+				map[string]interface{}{"name": "internal", "hostname": "*.internal.local"},
+			},
+		},
+		"status": map[string]interface{}{
+			"addresses": []interface{}{
+				map[string]interface{}{"type": "IPAddress", "value": "203.0.113.10"},
+				map[string]interface{}{"type": "Hostname", "value": "lb.example.net"},
+			},
+		},
+	}}
+
+	route := &unstructured.Unstructured{Object: map[string]interface{}{
+		"apiVersion": "gateway.networking.k8s.io/v1",
+		"kind":       "HTTPRoute",
+		"metadata": map[string]interface{}{
+			"name":      "web",
+			"namespace": "default",
+		},
+		"spec": map[string]interface{}{
+			"hostnames": []interface{}{"web.example.com", "web.other.com"},
+			"parentRefs": []interface{}{
+				map[string]interface{}{"name": "public", "namespace": "infra", "sectionName": "https"},
+			},
+		},
+		"status": map[string]interface{}{
+			"parents": []interface{}{acceptedParent("public", "infra", "https", "True")},
+		},
+	}}
+
+	// Gateways are created through the client since the fake tracker cannot
+	// guess the plural of the Gateway kind
+	c := &Controller{dynamic: dynamicfake.NewSimpleDynamicClient(runtime.NewScheme())}
+	if _, err := c.dynamic.Resource(gatewayGVR).Namespace("infra").Create(context.TODO(), gw, metav1.CreateOptions{}); err != nil {
+		t.Fatalf("error creating gateway: %v", err)
+	}
+
+	records, err := c.gatewayRouteRecords(route)
+	if err != nil {
+		t.Fatalf("gatewayRouteRecords error: %v", err)
+	}
+
+	expected := map[string][]string{"web.example.com": {"203.0.113.10"}}
+	if !reflect.DeepEqual(records, expected) {
+		t.Errorf("expected %v, got %v", expected, records)
+	}
+
+	// Listeners only allow routes from their own namespace by default
+	unstructured.SetNestedSlice(route.Object, []interface{}{
+		map[string]interface{}{"name": "public", "namespace": "infra", "sectionName": "internal"},
+	}, "spec", "parentRefs")
+	unstructured.SetNestedSlice(route.Object, []interface{}{acceptedParent("public", "infra", "internal", "True")}, "status", "parents")
+	unstructured.SetNestedStringSlice(route.Object, []string{"web.internal.local"}, "spec", "hostnames")
+	records, err = c.gatewayRouteRecords(route)
+	if err != nil {
+		t.Fatalf("gatewayRouteRecords error: %v", err)
+	}
+	if len(records) != 0 {
+		t.Errorf("expected no records for a listener not allowing the route namespace, got %v", records)
+	}
+	unstructured.SetNestedSlice(route.Object, []interface{}{
+		map[string]interface{}{"name": "public", "namespace": "infra", "sectionName": "https"},
+	}, "spec", "parentRefs")
+	unstructured.SetNestedStringSlice(route.Object, []string{"web.example.com"}, "spec", "hostnames")
+
+	// Routes the Gateway rejected, or has not processed yet, are not published
+	for _, parents := range [][]interface{}{
+		{acceptedParent("public", "infra", "https", "False")},
+		{acceptedParent("public", "infra", "", "True")},
+		nil,
+	} {
+		unstructured.SetNestedSlice(route.Object, parents, "status", "parents")
+		records, err = c.gatewayRouteRecords(route)
+		if err != nil {
+			t.Fatalf("gatewayRouteRecords error: %v", err)
+		}
+		if len(records) != 0 {
+			t.Errorf("parents %v: expected no records for a route not accepted, got %v", parents, records)
+		}
+	}
+	unstructured.SetNestedSlice(route.Object, []interface{}{acceptedParent("public", "infra", "https", "True")}, "status", "parents")
+
+	// A deleted Gateway contributes no hostnames
+	if err := c.dynamic.Resource(gatewayGVR).Namespace("infra").Delete(context.TODO(), "public", metav1.DeleteOptions{}); err != nil {
+		t.Fatalf("error deleting gateway: %v", err)
+	}
+	records, err = c.gatewayRouteRecords(route)
+	if err != nil {
+		t.Fatalf("gatewayRouteRecords error: %v", err)
+	}
+	if len(records) != 0 {
+		t.Errorf("expected no records, got %v", records)
+	}
+}
+
+func TestGatewayDeletedWithdrawsRecords(t *testing.T) {
+	gw := &unstructured.Unstructured{Object: map[string]interface{}{
+		"apiVersion": "gateway.networking.k8s.io/v1",
+		"kind":       "Gateway",
+		"metadata":   map[string]interface{}{"name": "public", "namespace": "default"},
+		"spec": map[string]interface{}{
+			"listeners": []interface{}{map[string]interface{}{"name": "https"}},
+		},
+		"status": map[string]interface{}{
+			"addresses": []interface{}{map[string]interface{}{"value": "203.0.113.10"}},
+		},
+	}}
+	route := &unstructured.Unstructured{Object: map[string]interface{}{
+		"apiVersion": "gateway.networking.k8s.io/v1",
+		"kind":       "HTTPRoute",
+		"metadata": map[string]interface{}{
+			"name":        "web",
+			"namespace":   "default",
+			"annotations": map[string]interface{}{annotationEnabled: "true"},
+		},
+		"spec": map[string]interface{}{
+			"hostnames":  []interface{}{"web.example.com"},
+			"parentRefs": []interface{}{map[string]interface{}{"name": "public"}},
+		},
+		"status": map[string]interface{}{
+			"parents": []interface{}{acceptedParent("public", "", "", "True")},
+		},
+	}}
+
+	fakeRedis := newFakeRedis()
+	c := &Controller{
+		dynamic:   dynamicfake.NewSimpleDynamicClient(runtime.NewScheme()),
+		redis:     fakeRedis,
+		published: newPublishedSet(),
+	}
+	gateways := c.dynamic.Resource(gatewayGVR).Namespace("default")
+	routes := c.dynamic.Resource(gatewayRouteGVRs[SourceGatewayHTTPRoute]).Namespace("default")
+	if _, err := routes.Create(context.TODO(), route, metav1.CreateOptions{}); err != nil {
+		t.Fatalf("error creating route: %v", err)
+	}
+
+	for _, deleteRoute := range []bool{false, true} {
+		if _, err := gateways.Create(context.TODO(), gw, metav1.CreateOptions{}); err != nil {
+			t.Fatalf("error creating gateway: %v", err)
+		}
+		if err := c.syncGatewayRoute(SourceGatewayHTTPRoute, "default/web"); err != nil {
+			t.Fatalf("syncGatewayRoute error: %v", err)
+		}
+		if _, ok := fakeRedis.records["web.example.com"]; !ok {
+			t.Fatal("expected web.example.com to be published")
+		}
+
+		if err := gateways.Delete(context.TODO(), "public", metav1.DeleteOptions{}); err != nil {
+			t.Fatalf("error deleting gateway: %v", err)
+		}
+		if deleteRoute {
+			c.handleGatewayRouteDelete(SourceGatewayHTTPRoute, route)
+		} else if err := c.syncGatewayRoute(SourceGatewayHTTPRoute, "default/web"); err != nil {
+			t.Fatalf("syncGatewayRoute error: %v", err)
+		}
+		if _, ok := fakeRedis.records["web.example.com"]; ok {
+			t.Errorf("deleteRoute %v: expected web.example.com to be withdrawn", deleteRoute)
+		}
+	}
+}
+
+// acceptedParent returns a route status parent with the given Accepted condition
+func acceptedParent(name, namespace, sectionName, status string) interface{} {
+	ref := map[string]interface{}{"name": name}
+	if namespace != "" {
+		ref["namespace"] = namespace
+	}
+	if sectionName != "" {
+		ref["sectionName"] = sectionName
+	}
+	return map[string]interface{}{
+		"parentRef":  ref,
+		"conditions": []interface{}{map[string]interface{}{"type": "Accepted", "status": status}},
+	}
+}
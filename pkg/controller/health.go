@@ -0,0 +1,162 @@
+package controller
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+)
+
+// redisCheckInterval is how often Redis connectivity is checked for readiness
+const redisCheckInterval = 10 * time.Second
+
+// redisCheckTimeout bounds a single Redis connectivity check
+const redisCheckTimeout = 5 * time.Second
+
+// maxSyncDuration is how long a worker may spend on one item before the
+// controller is reported unhealthy
+const maxSyncDuration = 5 * time.Minute
+
+// healthState tracks what the health and readiness endpoints report. The zero
+// value is ready to use.
+type healthState struct {
+	mu sync.Mutex
+	// synced is set once the informer caches have synced
+	synced bool
+	// redisChecked is set after the first Redis connectivity check
+	redisChecked bool
+	redisErr     error
+	// inflight holds when each item being synced was taken from the queue
+	inflight map[queueItem]time.Time
+}
+
+// startSync records that a worker started syncing item
+func (h *healthState) startSync(item queueItem, now time.Time) {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	if h.inflight == nil {
+		h.inflight = make(map[queueItem]time.Time)
+	}
+	h.inflight[item] = now
+}
+
+// finishSync records that a worker is done with item
+func (h *healthState) finishSync(item queueItem) {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	delete(h.inflight, item)
+}
+
+// setSynced records that the informer caches have synced
+func (h *healthState) setSynced() {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	h.synced = true
+}
+
+// setRedis records the result of a Redis connectivity check
+func (h *healthState) setRedis(err error) {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	h.redisChecked = true
+	h.redisErr = err
+}
+
+// healthChecks returns the liveness checks: the workers must not be stuck on
+// an item for longer than maxSyncDuration
+func (h *healthState) healthChecks(now time.Time) map[string]error {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+
+	var err error
+	for item, start := range h.inflight {
+		if d := now.Sub(start); d > maxSyncDuration {
+			err = fmt.Errorf("syncing %s %s for %s", item.source, item.key, d.Round(time.Second))
+			break
+		}
+	}
+	return map[string]error{"workers": err}
+}
+
+// readyChecks returns the readiness checks: the informer caches have synced,
+// the last Redis check succeeded and the leader status is known. The
+// controller runs without leader election, so it always acts as the leader.
+func (h *healthState) readyChecks() map[string]error {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+
+	checks := map[string]error{"leader": nil}
+	if !h.synced {
+		checks["informers"] = fmt.Errorf("caches not synced")
+	} else {
+		checks["informers"] = nil
+	}
+	switch {
+	case !h.redisChecked:
+		checks["redis"] = fmt.Errorf("not checked yet")
+	case h.redisErr != nil:
+		checks["redis"] = h.redisErr
+	default:
+		checks["redis"] = nil
+	}
+	return checks
+}
+
+// checkRedis pings Redis and records whether it is reachable
+func (c *Controller) checkRedis() {
+	ctx, cancel := context.WithTimeout(context.Background(), redisCheckTimeout)
+	defer cancel()
+
+	err := c.redis.Ping(ctx)
+	if err != nil {
+		err = fmt.Errorf("ping failed: %w", err)
+	}
+	c.health.setRedis(err)
+}
+
+// HealthzHandler serves the liveness of the controller: 200 while no worker
+// is stuck, 503 otherwise
+func (c *Controller) HealthzHandler() http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		writeChecks(w, c.health.healthChecks(time.Now()))
+	})
+}
+
+// ReadyzHandler serves the readiness of the controller: 200 once the caches
+// have synced and Redis is reachable, 503 otherwise
+func (c *Controller) ReadyzHandler() http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		writeChecks(w, c.health.readyChecks())
+	})
+}
+
+// writeChecks writes one line per check in the style of the Kubernetes API
+// server, with a 503 status when any check failed
+func writeChecks(w http.ResponseWriter, checks map[string]error) {
+	names := make([]string, 0, len(checks))
+	for name := range checks {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+
+	var b strings.Builder
+	status := http.StatusOK
+	for _, name := range names {
+		if err := checks[name]; err != nil {
+			status = http.StatusServiceUnavailable
+			fmt.Fprintf(&b, "[-]%s failed: %v\n", name, err)
+		} else {
+			fmt.Fprintf(&b, "[+]%s ok\n", name)
+		}
+	}
+	if status == http.StatusOK {
+		b.WriteString("ok\n")
+	}
+
+	w.Header().Set("Content-Type", "text/plain; charset=utf-8")
+	w.WriteHeader(status)
+	fmt.Fprint(w, b.String())
+}
@@ -0,0 +1,56 @@
+package controller
+
+import (
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestReadyz(t *testing.T) {
+	fake := newFakeRedis()
+	c := &Controller{redis: fake}
+
+	get := func() *httptest.ResponseRecorder {
+		rec := httptest.NewRecorder()
+		c.ReadyzHandler().ServeHTTP(rec, httptest.NewRequest(http.MethodGet, "/readyz", nil))
+		return rec
+	}
+
+	if rec := get(); rec.Code != http.StatusServiceUnavailable || !strings.Contains(rec.Body.String(), "[-]informers failed") {
+		t.Errorf("expected 503 before the caches synced, got %d: %s", rec.Code, rec.Body)
+	}
+
+	c.health.setSynced()
+	c.checkRedis()
+	if rec := get(); rec.Code != http.StatusOK {
+		t.Errorf("expected 200 once synced with Redis reachable, got %d: %s", rec.Code, rec.Body)
+	}
+
+	fake.pingErr = errors.New("connection refused")
+	c.checkRedis()
+	if rec := get(); rec.Code != http.StatusServiceUnavailable || !strings.Contains(rec.Body.String(), "[-]redis failed") {
+		t.Errorf("expected 503 while Redis is unreachable, got %d: %s", rec.Code, rec.Body)
+	}
+}
+
+func TestHealthChecks(t *testing.T) {
+	var h healthState
+	now := time.Now()
+	item := queueItem{source: SourceService, key: "default/app"}
+
+	h.startSync(item, now.Add(-time.Minute))
+	if err := h.healthChecks(now)["workers"]; err != nil {
+		t.Errorf("expected healthy workers, got %v", err)
+	}
+	if err := h.healthChecks(now.Add(maxSyncDuration))["workers"]; err == nil {
+		t.Error("expected a stuck worker to be reported")
+	}
+
+	h.finishSync(item)
+	if err := h.healthChecks(now.Add(maxSyncDuration))["workers"]; err != nil {
+		t.Errorf("expected healthy workers after the sync finished, got %v", err)
+	}
+}
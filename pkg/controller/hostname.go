@@ -0,0 +1,114 @@
+package controller
+
+import (
+	"fmt"
+	"regexp"
+	"strings"
+
+	"k8s.io/apimachinery/pkg/util/validation"
+)
+
+// maxHostnameLength is the longest hostname in presentation format, without
+// the trailing dot
+const maxHostnameLength = 253
+
+// DomainFilter restricts the hostnames the controller publishes. A hostname
+// is published when it is within one of the Include zones, or any zone when
+// none are given, matches Regex when set, and is neither within one of the
+// Exclude zones nor matches RegexExclude.
+type DomainFilter struct {
+	Include      []string
+	Exclude      []string
+	Regex        *regexp.Regexp
+	RegexExclude *regexp.Regexp
+}
+
+// WithDomainFilter restricts the published hostnames to those allowed by filter
+func WithDomainFilter(filter DomainFilter) Option {
+	return func(c *Controller) {
+		c.domainFilter = filter.normalize()
+	}
+}
+
+// normalize returns the filter with its zones in the form hostnames are
+// compared in, dropping empty zones
+func (f DomainFilter) normalize() DomainFilter {
+	normalized := f
+	normalized.Include, normalized.Exclude = nil, nil
+	for _, zone := range f.Include {
+		if zone = normalizeHostname(zone); zone != "" {
+			normalized.Include = append(normalized.Include, zone)
+		}
+	}
+	for _, zone := range f.Exclude {
+		if zone = normalizeHostname(zone); zone != "" {
+			normalized.Exclude = append(normalized.Exclude, zone)
+		}
+	}
+	return normalized
+}
+
+// Match reports whether the filter allows a normalized hostname
+func (f DomainFilter) Match(hostname string) bool {
+	if len(f.Include) > 0 && !inZones(hostname, f.Include) {
+		return false
+	}
+	if f.Regex != nil && !f.Regex.MatchString(hostname) {
+		return false
+	}
+	if inZones(hostname, f.Exclude) {
+		return false
+	}
+	return f.RegexExclude == nil || !f.RegexExclude.MatchString(hostname)
+}
+
+// inZones reports whether hostname is one of zones or a name below one
+func inZones(hostname string, zones []string) bool {
+	for _, zone := range zones {
+		if hostname == zone || strings.HasSuffix(hostname, "."+zone) {
+			return true
+		}
+	}
+	return false
+}
+
+// normalizeHostname returns a hostname in the form records are published
+// under: lowercase and without a trailing dot
+func normalizeHostname(hostname string) string {
+	return strings.ToLower(strings.TrimSuffix(strings.TrimSpace(hostname), "."))
+}
+
+// validateHostname checks that a normalized hostname is a valid RFC 1123 name.
+// A leading "*" label is accepted for wildcard records, and labels starting
+// with an underscore for service names such as _http._tcp.
+func validateHostname(hostname string) error {
+	if len(hostname) > maxHostnameLength {
+		return fmt.Errorf("%w %q: longer than %d characters", errInvalidHostname, hostname, maxHostnameLength)
+	}
+
+	labels := strings.Split(hostname, ".")
+	for i, label := range labels {
+		if i == 0 && label == "*" && len(labels) > 1 {
+			continue
+		}
+		if label != "_" && strings.HasPrefix(label, "_") {
+			label = label[1:]
+		}
+		if errs := validation.IsDNS1123Label(label); len(errs) > 0 {
+			return fmt.Errorf("%w %q: label %q: %s", errInvalidHostname, hostname, labels[i], strings.Join(errs, "; "))
+		}
+	}
+	return nil
+}
+
+// checkHostname returns an error unless hostname is valid and allowed by the
+// domain filter of the controller
+func (c *Controller) checkHostname(hostname string) error {
+	if err := validateHostname(hostname); err != nil {
+		return err
+	}
+	if !c.domainFilter.Match(hostname) {
+		return fmt.Errorf("%w %q: not allowed by the domain filter", errInvalidHostname, hostname)
+	}
+	return nil
+}
@@ -0,0 +1,87 @@
+package controller
+
+import (
+	"errors"
+	"regexp"
+	"strings"
+	"testing"
+
+	redisClient "github.com/upstash/redis-external-dns/pkg/redis"
+)
+
+func TestValidateHostname(t *testing.T) {
+	tests := []struct {
+		hostname string
+		valid    bool
+	}{
+		{hostname: "web.example.com", valid: true},
+		{hostname: "*.apps.example.com", valid: true},
+		{hostname: "_http._tcp.example.com", valid: true},
+		{hostname: "localhost", valid: true},
+		{hostname: "*", valid: false},
+		{hostname: "a.*.example.com", valid: false},
+		{hostname: "-web.example.com", valid: false},
+		{hostname: "web..example.com", valid: false},
+		{hostname: "web example.com", valid: false},
+		{hostname: strings.Repeat("a", 64) + ".example.com", valid: false},
+		{hostname: strings.Repeat("a.", 127) + "com", valid: false},
+	}
+
+	for _, tc := range tests {
+		err := validateHostname(tc.hostname)
+		if tc.valid && err != nil {
+			t.Errorf("%q: unexpected error: %v", tc.hostname, err)
+		}
+		if !tc.valid && !errors.Is(err, errInvalidHostname) {
+			t.Errorf("%q: expected an invalid hostname error, got %v", tc.hostname, err)
+		}
+	}
+}
+
+func TestDomainFilter(t *testing.T) {
+	filter := DomainFilter{
+		Include:      []string{"example.com.", "Example.org"},
+		Exclude:      []string{"internal.example.com"},
+		RegexExclude: regexp.MustCompile(`^admin\.`),
+	}.normalize()
+
+	tests := []struct {
+		hostname string
+		match    bool
+	}{
+		{hostname: "example.com", match: true},
+		{hostname: "web.example.com", match: true},
+		{hostname: "*.apps.example.org", match: true},
+		{hostname: "web.notexample.com", match: false},
+		{hostname: "payments.example.net", match: false},
+		{hostname: "db.internal.example.com", match: false},
+		{hostname: "admin.example.com", match: false},
+	}
+
+	for _, tc := range tests {
+		if got := filter.Match(tc.hostname); got != tc.match {
+			t.Errorf("%q: expected match %t, got %t", tc.hostname, tc.match, got)
+		}
+	}
+
+	if !(DomainFilter{}).Match("anything.example.net") {
+		t.Error("expected an empty filter to match every hostname")
+	}
+}
+
+func TestPublishRefusesFilteredHostnames(t *testing.T) {
+	fake := newFakeRedis()
+	c := &Controller{redis: fake, published: newPublishedSet()}
+	WithDomainFilter(DomainFilter{Include: []string{"example.com"}})(c)
+
+	record := &redisClient.DNSRecord{IPs: []string{"10.0.0.1"}}
+	if err := c.publish("web.example.net", record, "service/default/web"); !errors.Is(err, errInvalidHostname) {
+		t.Errorf("expected an invalid hostname error, got %v", err)
+	}
+	if err := c.publish("web.example.com", record, "service/default/web"); err != nil {
+		t.Errorf("unexpected error: %v", err)
+	}
+	if _, ok := fake.records["web.example.net"]; ok {
+		t.Error("expected the filtered hostname not to be published")
+	}
+}
@@ -0,0 +1,218 @@
+package controller
+
+import (
+	"context"
+	"fmt"
+	"time"
+
+	redisClient "github.com/upstash/redis-external-dns/pkg/redis"
+	networkingv1 "k8s.io/api/networking/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/apimachinery/pkg/watch"
+	"k8s.io/client-go/tools/cache"
+	"k8s.io/klog/v2"
+)
+
+// newIngressSource creates the source publishing records for annotated Ingresses
+func (c *Controller) newIngressSource() *source {
+	src := &source{
+		sync:      c.syncIngress,
+		reconcile: c.reconcileAllIngresses,
+	}
+
+	for _, namespace := range c.watchedNamespaces() {
+		namespace := namespace
+		informer := cache.NewSharedIndexInformer(
+			&cache.ListWatch{
+				ListFunc: func(options metav1.ListOptions) (runtime.Object, error) {
+					return c.client.NetworkingV1().Ingresses(namespace).List(context.TODO(), options)
+				},
+				WatchFunc: func(options metav1.ListOptions) (watch.Interface, error) {
+					return c.client.NetworkingV1().Ingresses(namespace).Watch(context.TODO(), options)
+				},
+			},
+			&networkingv1.Ingress{},
+			0, // Skip resync
+			cache.Indexers{},
+		)
+
+		informer.AddEventHandler(cache.ResourceEventHandlerFuncs{
+			AddFunc: func(obj interface{}) {
+				c.enqueue(SourceIngress, obj)
+			},
+			UpdateFunc: func(oldObj, newObj interface{}) {
+				c.enqueue(SourceIngress, newObj)
+			},
+			DeleteFunc: c.handleIngressDelete,
+		})
+		src.informers = append(src.informers, informer)
+	}
+
+	return src
+}
+
+func (c *Controller) handleIngressDelete(obj interface{}) {
+	// Get the ingress before it was deleted
+	ingress, ok := obj.(*networkingv1.Ingress)
+	if !ok {
+		tombstone, ok := obj.(cache.DeletedFinalStateUnknown)
+		if !ok {
+			klog.Errorf("Error decoding object, invalid type")
+			return
+		}
+		ingress, ok = tombstone.Obj.(*networkingv1.Ingress)
+		if !ok {
+			klog.Errorf("Error decoding object tombstone, invalid type")
+			return
+		}
+	}
+
+	ingress = ingress.DeepCopy()
+	ingress.Annotations = c.annotations(ingress.Annotations)
+	if enabled, ok := ingress.Annotations[annotationEnabled]; !ok || enabled != "true" {
+		return
+	}
+
+	// The hosts published for an earlier version of the ingress are deleted too
+	owner := ownerKey(SourceIngress, ingress.Namespace, ingress.Name)
+	for _, hostname := range appendUnique(c.published.hostnames(owner), ingressHostnames(ingress)...) {
+		c.deleteHostname(hostname, owner)
+	}
+}
+
+// syncIngress processes an ingress and updates Redis DNS records
+func (c *Controller) syncIngress(key string) error {
+	namespace, name, err := cache.SplitMetaNamespaceKey(key)
+	if err != nil {
+		return fmt.Errorf("invalid resource key: %s", key)
+	}
+
+	ingress, err := c.client.NetworkingV1().Ingresses(namespace).Get(context.TODO(), name, metav1.GetOptions{})
+	if err != nil {
+		return fmt.Errorf("error fetching ingress %s/%s: %v", namespace, name, err)
+	}
+	ingress.Annotations = c.annotations(ingress.Annotations)
+
+	// Check if ingress has our annotation
+	if enabled, ok := ingress.Annotations[annotationEnabled]; !ok || enabled != "true" {
+		return nil
+	}
+
+	owner := ownerKey(SourceIngress, namespace, name)
+	hostnames := ingressHostnames(ingress)
+	if len(hostnames) == 0 {
+		klog.Infof("No hosts found for ingress %s/%s", namespace, name)
+		c.withdrawStale(owner, func(string) bool { return false })
+		return nil
+	}
+
+	ttl, err := recordTTL(ingress.Annotations)
+	if err != nil {
+		return fmt.Errorf("%v for ingress %s/%s", err, namespace, name)
+	}
+	ips, cname, err := parseTargets(ingress.Annotations[annotationTarget])
+	if err != nil {
+		return fmt.Errorf("%v for ingress %s/%s", err, namespace, name)
+	}
+
+	// Collect the load balancer addresses assigned to the ingress, unless
+	// targets replace them. A load balancer with only a hostname, as on AWS,
+	// is published as a CNAME.
+	if len(ips) == 0 && cname == "" {
+		var lbHostnames []string
+		for _, lb := range ingress.Status.LoadBalancer.Ingress {
+			if lb.IP != "" {
+				ips = append(ips, lb.IP)
+			} else if lb.Hostname != "" {
+				lbHostnames = append(lbHostnames, normalizeHostname(lb.Hostname))
+			}
+		}
+		if len(ips) == 0 && len(lbHostnames) > 0 {
+			cname = lbHostnames[0]
+			if len(lbHostnames) > 1 {
+				klog.V(2).Infof("Publishing load balancer hostname %s of ingress %s/%s, skipping %v", cname, namespace, name, lbHostnames[1:])
+			}
+		}
+	}
+
+	if len(ips) == 0 && cname == "" {
+		// Never publish empty records, such as before the load balancer is
+		// provisioned
+		klog.Infof("No load balancer addresses for ingress %s/%s", namespace, name)
+		for _, hostname := range hostnames {
+			c.deleteHostname(hostname, owner)
+		}
+		c.withdrawStale(owner, func(string) bool { return false })
+		return nil
+	}
+
+	for _, hostname := range hostnames {
+		record := &redisClient.DNSRecord{
+			IPs:       ips,
+			TTL:       ttl,
+			UpdatedAt: time.Now(),
+			Metadata: map[string]string{
+				"namespace": namespace,
+				"ingress":   name,
+			},
+		}
+		if cname != "" {
+			record.Targets = map[string][]string{"CNAME": {cname}}
+		}
+
+		if err := c.publish(hostname, record, owner); err != nil {
+			return err
+		}
+
+		if cname != "" {
+			klog.Infof("Updated DNS record for %s with target %s", hostname, cname)
+		} else {
+			klog.Infof("Updated DNS record for %s with IPs: %v", hostname, ips)
+		}
+	}
+	// Withdraw the hosts removed from the rules
+	c.withdrawStale(owner, func(hostname string) bool { return containsString(hostnames, hostname) })
+	return nil
+}
+
+// reconcileAllIngresses enqueues every annotated ingress for processing
+func (c *Controller) reconcileAllIngresses() error {
+	for _, namespace := range c.watchedNamespaces() {
+		ingresses, err := c.client.NetworkingV1().Ingresses(namespace).List(context.TODO(), metav1.ListOptions{})
+		if err != nil {
+			return fmt.Errorf("error listing ingresses: %v", err)
+		}
+
+		for i := range ingresses.Items {
+			ing := &ingresses.Items[i]
+			if enabled, ok := c.annotations(ing.Annotations)[annotationEnabled]; !ok || enabled != "true" {
+				continue
+			}
+			c.enqueue(SourceIngress, ing)
+		}
+	}
+	return nil
+}
+
+// ingressHostnames returns the hosts of an ingress's rules together with any
+// hostnames from the hostname annotation, without duplicates
+func ingressHostnames(ingress *networkingv1.Ingress) []string {
+	seen := make(map[string]bool)
+	var hostnames []string
+	add := func(hostname string) {
+		if hostname == "" || seen[hostname] {
+			return
+		}
+		seen[hostname] = true
+		hostnames = append(hostnames, hostname)
+	}
+
+	for _, rule := range ingress.Spec.Rules {
+		add(rule.Host)
+	}
+	for _, hostname := range parseHostnames(ingress.Annotations[annotationHostname]) {
+		add(hostname)
+	}
+	return hostnames
+}
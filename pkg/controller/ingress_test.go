@@ -0,0 +1,123 @@
+package controller
+
+import (
+	"context"
+	"reflect"
+	"testing"
+
+	networkingv1 "k8s.io/api/networking/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/client-go/kubernetes/fake"
+)
+
+func TestIngressHostnames(t *testing.T) {
+	ingress := &networkingv1.Ingress{
+		ObjectMeta: metav1.ObjectMeta{
+			Name:      "test-ingress",
+			Namespace: "default",
+			Annotations: map[string]string{
+				annotationEnabled:  "true",
+				annotationHostname: "b.example.com, c.example.com",
+			},
+		},
+		Spec: networkingv1.IngressSpec{
+			Rules: []networkingv1.IngressRule{
+				{Host: "a.example.com"},
+				{Host: ""},
+				{Host: "b.example.com"},
+			},
+		},
+	}
+
+	expected := []string{"a.example.com", "b.example.com", "c.example.com"}
+	if got := ingressHostnames(ingress); !reflect.DeepEqual(got, expected) {
+		t.Errorf("expected %v, got %v", expected, got)
+	}
+}
+
+func TestSyncIngressLoadBalancer(t *testing.T) {
+	ingress := &networkingv1.Ingress{
+		ObjectMeta: metav1.ObjectMeta{
+			Name:        "web",
+			Namespace:   "default",
+			Annotations: map[string]string{annotationEnabled: "true"},
+		},
+		Spec: networkingv1.IngressSpec{
+			Rules: []networkingv1.IngressRule{{Host: "web.example.com"}},
+		},
+		Status: networkingv1.IngressStatus{
+			LoadBalancer: networkingv1.IngressLoadBalancerStatus{
+				Ingress: []networkingv1.IngressLoadBalancerIngress{{Hostname: "LB-1.elb.example.net"}},
+			},
+		},
+	}
+	client := fake.NewSimpleClientset(ingress)
+	fakeRedis := newFakeRedis()
+	c := &Controller{client: client, redis: fakeRedis, published: newPublishedSet()}
+
+	// A load balancer with only a hostname is published as a CNAME
+	if err := c.syncIngress("default/web"); err != nil {
+		t.Fatalf("syncIngress error: %v", err)
+	}
+	record := fakeRedis.records["web.example.com"]
+	if record == nil || len(record.IPs) != 0 || !reflect.DeepEqual(record.Targets["CNAME"], []string{"lb-1.elb.example.net"}) {
+		t.Fatalf("expected a CNAME to the load balancer hostname, got %+v", record)
+	}
+
+	// Without load balancer addresses nothing is published
+	ingress.Status.LoadBalancer.Ingress = nil
+	if _, err := client.NetworkingV1().Ingresses("default").Update(context.TODO(), ingress, metav1.UpdateOptions{}); err != nil {
+		t.Fatalf("error updating ingress: %v", err)
+	}
+	if err := c.syncIngress("default/web"); err != nil {
+		t.Fatalf("syncIngress error: %v", err)
+	}
+	if record, ok := fakeRedis.records["web.example.com"]; ok {
+		t.Errorf("expected no record without load balancer addresses, got %+v", record)
+	}
+}
+
+func TestSyncIngressWithdrawsRemovedHosts(t *testing.T) {
+	ingress := &networkingv1.Ingress{
+		ObjectMeta: metav1.ObjectMeta{
+			Name:        "web",
+			Namespace:   "default",
+			Annotations: map[string]string{annotationEnabled: "true"},
+		},
+		Spec: networkingv1.IngressSpec{
+			Rules: []networkingv1.IngressRule{{Host: "a.example.com"}, {Host: "b.example.com"}},
+		},
+		Status: networkingv1.IngressStatus{
+			LoadBalancer: networkingv1.IngressLoadBalancerStatus{
+				Ingress: []networkingv1.IngressLoadBalancerIngress{{IP: "203.0.113.10"}},
+			},
+		},
+	}
+	client := fake.NewSimpleClientset(ingress)
+	fakeRedis := newFakeRedis()
+	c := &Controller{client: client, redis: fakeRedis, published: newPublishedSet()}
+
+	if err := c.syncIngress("default/web"); err != nil {
+		t.Fatalf("syncIngress error: %v", err)
+	}
+
+	ingress.Spec.Rules = ingress.Spec.Rules[:1]
+	if _, err := client.NetworkingV1().Ingresses("default").Update(context.TODO(), ingress, metav1.UpdateOptions{}); err != nil {
+		t.Fatalf("error updating ingress: %v", err)
+	}
+	if err := c.syncIngress("default/web"); err != nil {
+		t.Fatalf("syncIngress error: %v", err)
+	}
+	if _, ok := fakeRedis.records["a.example.com"]; !ok {
+		t.Error("expected a.example.com to stay published")
+	}
+	if _, ok := fakeRedis.records["b.example.com"]; ok {
+		t.Error("expected b.example.com to be withdrawn")
+	}
+
+	// Deleting the ingress withdraws its hosts
+	c.handleIngressDelete(ingress)
+	if len(fakeRedis.records) != 0 {
+		t.Errorf("expected no records after deleting the ingress, got %v", fakeRedis.records)
+	}
+}
@@ -0,0 +1,316 @@
+package controller
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/promhttp"
+	redisClient "github.com/upstash/redis-external-dns/pkg/redis"
+	"k8s.io/client-go/util/workqueue"
+)
+
+const metricsNamespace = "upstashternal_dns"
+
+// Results of a sync, as recorded by the sync metrics
+const (
+	resultSuccess  = "success"
+	resultError    = "error"
+	resultConflict = "conflict"
+)
+
+var (
+	syncTotal = prometheus.NewCounterVec(prometheus.CounterOpts{
+		Namespace: metricsNamespace,
+		Name:      "sync_total",
+		Help:      "Number of objects synced, by source and result.",
+	}, []string{"source", "result"})
+
+	syncDuration = prometheus.NewHistogramVec(prometheus.HistogramOpts{
+		Namespace: metricsNamespace,
+		Name:      "sync_duration_seconds",
+		Help:      "Time taken to sync an object, by source and result.",
+		Buckets:   prometheus.DefBuckets,
+	}, []string{"source", "result"})
+
+	redisDuration = prometheus.NewHistogramVec(prometheus.HistogramOpts{
+		Namespace: metricsNamespace,
+		Name:      "redis_operation_duration_seconds",
+		Help:      "Latency of Redis operations, by operation.",
+		Buckets:   prometheus.DefBuckets,
+	}, []string{"operation"})
+
+	redisErrors = prometheus.NewCounterVec(prometheus.CounterOpts{
+		Namespace: metricsNamespace,
+		Name:      "redis_operation_errors_total",
+		Help:      "Number of failed Redis operations, by operation.",
+	}, []string{"operation"})
+
+	publishedHostnames = prometheus.NewGaugeVec(prometheus.GaugeOpts{
+		Namespace: metricsNamespace,
+		Name:      "published_hostnames",
+		Help:      "Number of hostnames published by this controller, by source.",
+	}, []string{"source"})
+
+	publishedEndpoints = prometheus.NewGaugeVec(prometheus.GaugeOpts{
+		Namespace: metricsNamespace,
+		Name:      "published_endpoints",
+		Help:      "Number of IPs published by this controller across its hostnames, by source.",
+	}, []string{"source"})
+
+	lastReconcile = prometheus.NewGaugeVec(prometheus.GaugeOpts{
+		Namespace: metricsNamespace,
+		Name:      "last_reconcile_timestamp_seconds",
+		Help:      "Time of the last successful full reconcile, by source.",
+	}, []string{"source"})
+)
+
+func init() {
+	prometheus.MustRegister(syncTotal, syncDuration, redisDuration, redisErrors, publishedHostnames, publishedEndpoints, lastReconcile)
+	prometheus.MustRegister(workqueueDepth, workqueueAdds, workqueueLatency, workqueueWorkDuration,
+		workqueueUnfinishedWork, workqueueLongestRunning, workqueueRetries)
+	workqueue.SetProvider(workqueueMetricsProvider{})
+}
+
+// MetricsHandler serves the controller metrics in the Prometheus exposition
+// format negotiated with the scraper
+func MetricsHandler() http.Handler {
+	return promhttp.HandlerFor(prometheus.DefaultGatherer, promhttp.HandlerOpts{})
+}
+
+// syncResult classifies the outcome of a sync for the sync metrics
+func syncResult(err error) string {
+	switch {
+	case err == nil:
+		return resultSuccess
+	case errors.Is(err, errConflict):
+		return resultConflict
+	}
+	return resultError
+}
+
+// publishedSet tracks the hostnames published by this controller, the
+// resource that published each and the number of IPs behind it, for the
+// published metrics and to withdraw hostnames a resource no longer publishes
+type publishedSet struct {
+	mu      sync.Mutex
+	records map[string]map[string]publishedRecord // source -> hostname -> record
+}
+
+// publishedRecord describes a hostname in a publishedSet
+type publishedRecord struct {
+	owner string
+	ips   int
+}
+
+func newPublishedSet() *publishedSet {
+	return &publishedSet{records: make(map[string]map[string]publishedRecord)}
+}
+
+// set records the IPs published for hostname by owner
+func (p *publishedSet) set(owner, hostname string, ips int) {
+	if p == nil {
+		return
+	}
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	source := ownerSource(owner)
+	if p.records[source] == nil {
+		p.records[source] = make(map[string]publishedRecord)
+	}
+	p.records[source][hostname] = publishedRecord{owner: owner, ips: ips}
+	p.update(source)
+}
+
+// remove forgets the hostname published by owner
+func (p *publishedSet) remove(owner, hostname string) {
+	if p == nil {
+		return
+	}
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	source := ownerSource(owner)
+	delete(p.records[source], hostname)
+	p.update(source)
+}
+
+// hostnames returns the hostnames published by owner, sorted
+func (p *publishedSet) hostnames(owner string) []string {
+	if p == nil {
+		return nil
+	}
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	var hostnames []string
+	for hostname, record := range p.records[ownerSource(owner)] {
+		if record.owner == owner {
+			hostnames = append(hostnames, hostname)
+		}
+	}
+	sort.Strings(hostnames)
+	return hostnames
+}
+
+func (p *publishedSet) update(source string) {
+	endpoints := 0
+	for _, record := range p.records[source] {
+		endpoints += record.ips
+	}
+	publishedHostnames.WithLabelValues(source).Set(float64(len(p.records[source])))
+	publishedEndpoints.WithLabelValues(source).Set(float64(endpoints))
+}
+
+// ownerSource returns the source of an owner key such as service/default/web
+func ownerSource(owner string) string {
+	source, _, _ := strings.Cut(owner, "/")
+	return source
+}
+
+// instrumentedRedis records the latency and errors of every operation of a
+// Redis client
+type instrumentedRedis struct {
+	redisClient.Client
+}
+
+func (r instrumentedRedis) observe(operation string, start time.Time, err error) {
+	redisDuration.WithLabelValues(operation).Observe(time.Since(start).Seconds())
+	// Conflicts are refused by the controller, not failures of Redis
+	if err != nil && !errors.Is(err, errConflict) {
+		redisErrors.WithLabelValues(operation).Inc()
+	}
+}
+
+func (r instrumentedRedis) SetRecord(ctx context.Context, hostname string, record *redisClient.DNSRecord) (err error) {
+	defer func(start time.Time) { r.observe("SetRecord", start, err) }(time.Now())
+	return r.Client.SetRecord(ctx, hostname, record)
+}
+
+func (r instrumentedRedis) GetRecord(ctx context.Context, hostname string) (record *redisClient.DNSRecord, err error) {
+	defer func(start time.Time) { r.observe("GetRecord", start, err) }(time.Now())
+	return r.Client.GetRecord(ctx, hostname)
+}
+
+func (r instrumentedRedis) DeleteRecord(ctx context.Context, hostname string) (err error) {
+	defer func(start time.Time) { r.observe("DeleteRecord", start, err) }(time.Now())
+	return r.Client.DeleteRecord(ctx, hostname)
+}
+
+// UpdateRecord is labelled DeleteRecord when the update deletes the record,
+// such as when a hostname is unpublished, so writes and deletes are told apart
+func (r instrumentedRedis) UpdateRecord(ctx context.Context, hostname string, update redisClient.UpdateFunc) (err error) {
+	operation := "UpdateRecord"
+	defer func(start time.Time) { r.observe(operation, start, err) }(time.Now())
+	return r.Client.UpdateRecord(ctx, hostname, func(existing *redisClient.DNSRecord) (*redisClient.DNSRecord, error) {
+		record, err := update(existing)
+		if err == nil && record == nil {
+			operation = "DeleteRecord"
+		} else {
+			// The update may be retried with a record changed in the meantime
+			operation = "UpdateRecord"
+		}
+		return record, err
+	})
+}
+
+func (r instrumentedRedis) Ping(ctx context.Context) (err error) {
+	defer func(start time.Time) { r.observe("Ping", start, err) }(time.Now())
+	return r.Client.Ping(ctx)
+}
+
+func (r instrumentedRedis) MigrateKeys(ctx context.Context) (migrated int, err error) {
+	defer func(start time.Time) { r.observe("MigrateKeys", start, err) }(time.Now())
+	return r.Client.MigrateKeys(ctx)
+}
+
+// workqueueMetricsProvider exposes the client-go workqueue metrics, labelled
+// with the name of the queue
+type workqueueMetricsProvider struct{}
+
+var (
+	workqueueDepth = prometheus.NewGaugeVec(prometheus.GaugeOpts{
+		Namespace: metricsNamespace,
+		Subsystem: "workqueue",
+		Name:      "depth",
+		Help:      "Current depth of the workqueue.",
+	}, []string{"name"})
+
+	workqueueAdds = prometheus.NewCounterVec(prometheus.CounterOpts{
+		Namespace: metricsNamespace,
+		Subsystem: "workqueue",
+		Name:      "adds_total",
+		Help:      "Number of adds handled by the workqueue.",
+	}, []string{"name"})
+
+	workqueueLatency = prometheus.NewHistogramVec(prometheus.HistogramOpts{
+		Namespace: metricsNamespace,
+		Subsystem: "workqueue",
+		Name:      "queue_duration_seconds",
+		Help:      "Time an item stays in the workqueue before being processed.",
+		Buckets:   prometheus.ExponentialBuckets(10e-9, 10, 10),
+	}, []string{"name"})
+
+	workqueueWorkDuration = prometheus.NewHistogramVec(prometheus.HistogramOpts{
+		Namespace: metricsNamespace,
+		Subsystem: "workqueue",
+		Name:      "work_duration_seconds",
+		Help:      "Time taken to process an item from the workqueue.",
+		Buckets:   prometheus.ExponentialBuckets(10e-9, 10, 10),
+	}, []string{"name"})
+
+	workqueueUnfinishedWork = prometheus.NewGaugeVec(prometheus.GaugeOpts{
+		Namespace: metricsNamespace,
+		Subsystem: "workqueue",
+		Name:      "unfinished_work_seconds",
+		Help:      "Seconds of work in progress that has not been observed by work_duration_seconds yet.",
+	}, []string{"name"})
+
+	workqueueLongestRunning = prometheus.NewGaugeVec(prometheus.GaugeOpts{
+		Namespace: metricsNamespace,
+		Subsystem: "workqueue",
+		Name:      "longest_running_processor_seconds",
+		Help:      "Seconds the longest running processor of the workqueue has been running.",
+	}, []string{"name"})
+
+	workqueueRetries = prometheus.NewCounterVec(prometheus.CounterOpts{
+		Namespace: metricsNamespace,
+		Subsystem: "workqueue",
+		Name:      "retries_total",
+		Help:      "Number of retries handled by the workqueue.",
+	}, []string{"name"})
+)
+
+func (workqueueMetricsProvider) NewDepthMetric(name string) workqueue.GaugeMetric {
+	return workqueueDepth.WithLabelValues(name)
+}
+
+func (workqueueMetricsProvider) NewAddsMetric(name string) workqueue.CounterMetric {
+	return workqueueAdds.WithLabelValues(name)
+}
+
+func (workqueueMetricsProvider) NewLatencyMetric(name string) workqueue.HistogramMetric {
+	return workqueueLatency.WithLabelValues(name)
+}
+
+func (workqueueMetricsProvider) NewWorkDurationMetric(name string) workqueue.HistogramMetric {
+	return workqueueWorkDuration.WithLabelValues(name)
+}
+
+func (workqueueMetricsProvider) NewUnfinishedWorkSecondsMetric(name string) workqueue.SettableGaugeMetric {
+	return workqueueUnfinishedWork.WithLabelValues(name)
+}
+
+func (workqueueMetricsProvider) NewLongestRunningProcessorSecondsMetric(name string) workqueue.SettableGaugeMetric {
+	return workqueueLongestRunning.WithLabelValues(name)
+}
+
+func (workqueueMetricsProvider) NewRetriesMetric(name string) workqueue.CounterMetric {
+	return workqueueRetries.WithLabelValues(name)
+}
@@ -0,0 +1,95 @@
+package controller
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"testing"
+
+	"github.com/prometheus/client_golang/prometheus/testutil"
+	"github.com/upstash/redis-external-dns/pkg/redis"
+)
+
+func TestSyncResult(t *testing.T) {
+	tests := []struct {
+		err      error
+		expected string
+	}{
+		{err: nil, expected: resultSuccess},
+		{err: fmt.Errorf("%w: web.example.com is published by service/default/api", errConflict), expected: resultConflict},
+		{err: fmt.Errorf("error fetching service default/web"), expected: resultError},
+	}
+
+	for _, tc := range tests {
+		if got := syncResult(tc.err); got != tc.expected {
+			t.Errorf("%v: expected %s, got %s", tc.err, tc.expected, got)
+		}
+	}
+}
+
+func TestPublishedMetrics(t *testing.T) {
+	c := &Controller{redis: instrumentedRedis{newFakeRedis()}, published: newPublishedSet()}
+	owner := ownerKey(SourceIngress, "default", "web")
+
+	for hostname, ips := range map[string][]string{
+		"web.example.com": {"10.0.0.1", "10.0.0.2"},
+		"www.example.com": {"10.0.0.1"},
+	} {
+		if err := c.publish(hostname, &redis.DNSRecord{IPs: ips, TTL: 10}, owner); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if err := c.unpublish("www.example.com", owner); err != nil {
+		t.Fatal(err)
+	}
+
+	if got := testutil.ToFloat64(publishedHostnames.WithLabelValues(SourceIngress)); got != 1 {
+		t.Errorf("expected 1 published hostname, got %v", got)
+	}
+	if got := testutil.ToFloat64(publishedEndpoints.WithLabelValues(SourceIngress)); got != 2 {
+		t.Errorf("expected 2 published endpoints, got %v", got)
+	}
+
+	// Conflicts are not Redis errors
+	other := ownerKey(SourceIngress, "default", "other")
+	before := testutil.ToFloat64(redisErrors.WithLabelValues("UpdateRecord"))
+	if err := c.publish("web.example.com", &redis.DNSRecord{IPs: []string{"10.0.0.3"}, TTL: 10}, other); err == nil {
+		t.Fatal("expected a conflict")
+	}
+	if got := testutil.ToFloat64(redisErrors.WithLabelValues("UpdateRecord")); got != before {
+		t.Errorf("expected no Redis error for a conflict, got %v", got-before)
+	}
+}
+
+// failingRedis applies updates like fakeRedis but reports them as failed
+type failingRedis struct {
+	*fakeRedis
+}
+
+func (f failingRedis) UpdateRecord(ctx context.Context, hostname string, update redis.UpdateFunc) error {
+	if err := f.fakeRedis.UpdateRecord(ctx, hostname, update); err != nil {
+		return err
+	}
+	return errors.New("connection reset")
+}
+
+func TestRedisOperationLabels(t *testing.T) {
+	c := &Controller{redis: instrumentedRedis{failingRedis{newFakeRedis()}}, published: newPublishedSet()}
+	owner := ownerKey(SourceIngress, "default", "web")
+
+	updates := testutil.ToFloat64(redisErrors.WithLabelValues("UpdateRecord"))
+	deletes := testutil.ToFloat64(redisErrors.WithLabelValues("DeleteRecord"))
+	if err := c.publish("web.example.com", &redis.DNSRecord{IPs: []string{"10.0.0.1"}, TTL: 10}, owner); err == nil {
+		t.Fatal("expected an error")
+	}
+	if err := c.unpublish("web.example.com", owner); err == nil {
+		t.Fatal("expected an error")
+	}
+
+	if got := testutil.ToFloat64(redisErrors.WithLabelValues("UpdateRecord")) - updates; got != 1 {
+		t.Errorf("expected 1 UpdateRecord error for the publish, got %v", got)
+	}
+	if got := testutil.ToFloat64(redisErrors.WithLabelValues("DeleteRecord")) - deletes; got != 1 {
+		t.Errorf("expected 1 DeleteRecord error for the unpublish, got %v", got)
+	}
+}
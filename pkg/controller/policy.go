@@ -0,0 +1,202 @@
+package controller
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"os"
+	"strings"
+
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/labels"
+	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/apimachinery/pkg/watch"
+	"k8s.io/client-go/tools/cache"
+	"sigs.k8s.io/yaml"
+)
+
+// errHostnameNotAllowed is returned when a namespace publishes a hostname
+// outside the suffixes its hostname policies allow
+var errHostnameNotAllowed = errors.New("hostname not allowed")
+
+// HostnamePolicy allows the namespaces it selects to publish hostnames within
+// its suffixes. Namespaces are selected by name, by labels, or both.
+type HostnamePolicy struct {
+	Namespaces        []string              `json:"namespaces,omitempty"`
+	NamespaceSelector *metav1.LabelSelector `json:"namespaceSelector,omitempty"`
+	Suffixes          []string              `json:"suffixes"`
+}
+
+// HostnamePolicies maps namespaces to the hostname suffixes they may publish.
+// A namespace selected by no policy may not publish any hostname.
+type HostnamePolicies struct {
+	Policies []HostnamePolicy `json:"policies"`
+
+	selectors []labels.Selector
+}
+
+// ParseHostnamePolicies reads hostname policies in YAML or JSON:
+//
+//	policies:
+//	- namespaces: [payments]
+//	  suffixes: [payments.example.com]
+//	- namespaceSelector:
+//	    matchLabels:
+//	      team: web
+//	  suffixes: [web.example.com, www.example.com]
+func ParseHostnamePolicies(data []byte) (*HostnamePolicies, error) {
+	var p HostnamePolicies
+	if err := yaml.UnmarshalStrict(data, &p); err != nil {
+		return nil, fmt.Errorf("error parsing hostname policies: %v", err)
+	}
+
+	p.selectors = make([]labels.Selector, len(p.Policies))
+	for i := range p.Policies {
+		policy := &p.Policies[i]
+		if len(policy.Namespaces) == 0 && policy.NamespaceSelector == nil {
+			return nil, fmt.Errorf("hostname policy %d selects no namespaces", i)
+		}
+		if len(policy.Suffixes) == 0 {
+			return nil, fmt.Errorf("hostname policy %d allows no suffixes", i)
+		}
+		for j, suffix := range policy.Suffixes {
+			policy.Suffixes[j] = normalizeHostname(suffix)
+		}
+		if policy.NamespaceSelector != nil {
+			selector, err := metav1.LabelSelectorAsSelector(policy.NamespaceSelector)
+			if err != nil {
+				return nil, fmt.Errorf("invalid namespace selector in hostname policy %d: %v", i, err)
+			}
+			p.selectors[i] = selector
+		}
+	}
+	return &p, nil
+}
+
+// LoadHostnamePolicies reads hostname policies from a file
+func LoadHostnamePolicies(path string) (*HostnamePolicies, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, fmt.Errorf("error reading hostname policies: %v", err)
+	}
+	return ParseHostnamePolicies(data)
+}
+
+// WithHostnamePolicies restricts the hostnames each namespace may publish
+func WithHostnamePolicies(policies *HostnamePolicies) Option {
+	return func(c *Controller) {
+		c.policies = policies
+	}
+}
+
+// usesLabels reports whether any policy selects namespaces by labels
+func (p *HostnamePolicies) usesLabels() bool {
+	for _, selector := range p.selectors {
+		if selector != nil {
+			return true
+		}
+	}
+	return false
+}
+
+// allows reports whether a namespace with the given labels may publish hostname
+func (p *HostnamePolicies) allows(namespace string, namespaceLabels labels.Set, hostname string) bool {
+	for i, policy := range p.Policies {
+		if !policySelects(policy, p.selectors[i], namespace, namespaceLabels) {
+			continue
+		}
+		if inZones(hostname, policy.Suffixes) {
+			return true
+		}
+	}
+	return false
+}
+
+// policySelects reports whether a policy applies to a namespace. Both the
+// names and the selector must match when a policy sets both.
+func policySelects(policy HostnamePolicy, selector labels.Selector, namespace string, namespaceLabels labels.Set) bool {
+	if len(policy.Namespaces) > 0 && !containsString(policy.Namespaces, namespace) {
+		return false
+	}
+	return selector == nil || selector.Matches(namespaceLabels)
+}
+
+// containsString reports whether list holds value
+func containsString(list []string, value string) bool {
+	for _, v := range list {
+		if v == value {
+			return true
+		}
+	}
+	return false
+}
+
+// checkPolicy returns an error unless the hostname policies allow namespace
+// to publish hostname
+func (c *Controller) checkPolicy(namespace, hostname string) error {
+	if c.policies == nil {
+		return nil
+	}
+
+	var namespaceLabels labels.Set
+	if c.policies.usesLabels() {
+		var err error
+		if namespaceLabels, err = c.namespaceLabels(namespace); err != nil {
+			return err
+		}
+	}
+
+	if !c.policies.allows(namespace, namespaceLabels, hostname) {
+		return fmt.Errorf("%w: %s may not be published from namespace %s", errHostnameNotAllowed, hostname, namespace)
+	}
+	return nil
+}
+
+// namespaceLabels returns the labels of a namespace, from the namespace
+// informer when one runs
+func (c *Controller) namespaceLabels(namespace string) (labels.Set, error) {
+	if c.namespaceInformer != nil {
+		obj, exists, err := c.namespaceInformer.GetStore().GetByKey(namespace)
+		if err != nil {
+			return nil, fmt.Errorf("error fetching namespace %s: %v", namespace, err)
+		}
+		if !exists {
+			return nil, fmt.Errorf("namespace %s not found", namespace)
+		}
+		return obj.(*corev1.Namespace).Labels, nil
+	}
+
+	ns, err := c.client.CoreV1().Namespaces().Get(context.TODO(), namespace, metav1.GetOptions{})
+	if err != nil {
+		return nil, fmt.Errorf("error fetching namespace %s: %v", namespace, err)
+	}
+	return ns.Labels, nil
+}
+
+// newNamespaceInformer creates an informer caching the namespaces, so their
+// labels can be matched without a request per hostname
+func (c *Controller) newNamespaceInformer() cache.SharedIndexInformer {
+	return cache.NewSharedIndexInformer(
+		&cache.ListWatch{
+			ListFunc: func(options metav1.ListOptions) (runtime.Object, error) {
+				return c.client.CoreV1().Namespaces().List(context.TODO(), options)
+			},
+			WatchFunc: func(options metav1.ListOptions) (watch.Interface, error) {
+				return c.client.CoreV1().Namespaces().Watch(context.TODO(), options)
+			},
+		},
+		&corev1.Namespace{},
+		0, // Skip resync
+		cache.Indexers{},
+	)
+}
+
+// ownerNamespace returns the namespace of the resource identified by an owner key
+func ownerNamespace(owner string) string {
+	parts := strings.SplitN(owner, "/", 3)
+	if len(parts) < 3 {
+		return ""
+	}
+	return parts[1]
+}
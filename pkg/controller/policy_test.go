@@ -0,0 +1,82 @@
+package controller
+
+import (
+	"errors"
+	"testing"
+
+	redisClient "github.com/upstash/redis-external-dns/pkg/redis"
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/client-go/kubernetes/fake"
+)
+
+const testPolicies = `
+policies:
+- namespaces: [payments]
+  suffixes: [payments.example.com.]
+- namespaceSelector:
+    matchLabels:
+      team: web
+  suffixes: [web.example.com]
+`
+
+func TestParseHostnamePolicies(t *testing.T) {
+	tests := []struct {
+		input     string
+		shouldErr bool
+	}{
+		{input: testPolicies},
+		{input: `policies: []`},
+		{input: `policies: [{suffixes: [example.com]}]`, shouldErr: true},
+		{input: `policies: [{namespaces: [web]}]`, shouldErr: true},
+		{input: `policies: [{namespaces: [web], suffix: [example.com]}]`, shouldErr: true},
+		{input: `policies: [{namespaceSelector: {matchExpressions: [{key: team, operator: Bogus}]}, suffixes: [example.com]}]`, shouldErr: true},
+	}
+
+	for _, tc := range tests {
+		_, err := ParseHostnamePolicies([]byte(tc.input))
+		if tc.shouldErr && err == nil {
+			t.Errorf("%q: expected error", tc.input)
+		}
+		if !tc.shouldErr && err != nil {
+			t.Errorf("%q: unexpected error: %v", tc.input, err)
+		}
+	}
+}
+
+func TestCheckPolicy(t *testing.T) {
+	policies, err := ParseHostnamePolicies([]byte(testPolicies))
+	if err != nil {
+		t.Fatalf("error parsing policies: %v", err)
+	}
+	client := fake.NewSimpleClientset(
+		&corev1.Namespace{ObjectMeta: metav1.ObjectMeta{Name: "payments"}},
+		&corev1.Namespace{ObjectMeta: metav1.ObjectMeta{Name: "frontend", Labels: map[string]string{"team": "web"}}},
+		&corev1.Namespace{ObjectMeta: metav1.ObjectMeta{Name: "sandbox"}},
+	)
+	c := &Controller{client: client, redis: newFakeRedis(), published: newPublishedSet(), policies: policies}
+
+	tests := []struct {
+		namespace string
+		hostname  string
+		allowed   bool
+	}{
+		{namespace: "payments", hostname: "payments.example.com", allowed: true},
+		{namespace: "payments", hostname: "api.payments.example.com", allowed: true},
+		{namespace: "payments", hostname: "web.example.com", allowed: false},
+		{namespace: "frontend", hostname: "*.web.example.com", allowed: true},
+		{namespace: "frontend", hostname: "payments.example.com", allowed: false},
+		{namespace: "sandbox", hostname: "sandbox.example.com", allowed: false},
+	}
+
+	for _, tc := range tests {
+		owner := ownerKey(SourceService, tc.namespace, "app")
+		err := c.publish(tc.hostname, &redisClient.DNSRecord{IPs: []string{"10.0.0.1"}}, owner)
+		if tc.allowed && err != nil {
+			t.Errorf("%s in %s: unexpected error: %v", tc.hostname, tc.namespace, err)
+		}
+		if !tc.allowed && !errors.Is(err, errHostnameNotAllowed) {
+			t.Errorf("%s in %s: expected hostname not allowed, got %v", tc.hostname, tc.namespace, err)
+		}
+	}
+}
@@ -0,0 +1,71 @@
+package controller
+
+import (
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/labels"
+	"k8s.io/klog/v2"
+)
+
+// WithNamespaces restricts the controller to the given namespaces, with one
+// informer per namespace so it can run with namespaced RBAC. All namespaces
+// are watched by default.
+func WithNamespaces(namespaces ...string) Option {
+	return func(c *Controller) {
+		c.namespaces = nil
+		for _, namespace := range namespaces {
+			if namespace != "" {
+				c.namespaces = appendUnique(c.namespaces, namespace)
+			}
+		}
+	}
+}
+
+// WithNamespaceSelector restricts the controller to the objects of the
+// namespaces whose labels match selector
+func WithNamespaceSelector(selector labels.Selector) Option {
+	return func(c *Controller) {
+		if selector != nil && !selector.Empty() {
+			c.namespaceSelector = selector
+		}
+	}
+}
+
+// WithServiceSelector restricts the controller to the Services whose labels
+// match selector
+func WithServiceSelector(selector labels.Selector) Option {
+	return func(c *Controller) {
+		if selector != nil && !selector.Empty() {
+			c.serviceSelector = selector
+		}
+	}
+}
+
+// watchedNamespaces returns the namespaces to run informers and list objects
+// in, a single metav1.NamespaceAll when the controller watches every namespace
+func (c *Controller) watchedNamespaces() []string {
+	if len(c.namespaces) == 0 {
+		return []string{metav1.NamespaceAll}
+	}
+	return c.namespaces
+}
+
+// serviceListOptions applies the Service label selector to a list or watch
+func (c *Controller) serviceListOptions(options *metav1.ListOptions) {
+	if c.serviceSelector != nil {
+		options.LabelSelector = c.serviceSelector.String()
+	}
+}
+
+// inScope reports whether the objects of a namespace are published, according
+// to the namespace label selector
+func (c *Controller) inScope(namespace string) bool {
+	if c.namespaceSelector == nil {
+		return true
+	}
+	namespaceLabels, err := c.namespaceLabels(namespace)
+	if err != nil {
+		klog.Errorf("Error matching namespace selector: %v", err)
+		return false
+	}
+	return c.namespaceSelector.Matches(namespaceLabels)
+}
@@ -0,0 +1,60 @@
+package controller
+
+import (
+	"sort"
+	"testing"
+
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/labels"
+	"k8s.io/client-go/kubernetes/fake"
+	"k8s.io/client-go/util/workqueue"
+)
+
+func TestReconcileScope(t *testing.T) {
+	service := func(namespace, name string, serviceLabels map[string]string) *corev1.Service {
+		return &corev1.Service{
+			ObjectMeta: metav1.ObjectMeta{
+				Name:      name,
+				Namespace: namespace,
+				Labels:    serviceLabels,
+				Annotations: map[string]string{
+					annotationEnabled:  "true",
+					annotationHostname: name + ".example.com",
+				},
+			},
+		}
+	}
+	client := fake.NewSimpleClientset(
+		&corev1.Namespace{ObjectMeta: metav1.ObjectMeta{Name: "team-a", Labels: map[string]string{"dns": "enabled"}}},
+		&corev1.Namespace{ObjectMeta: metav1.ObjectMeta{Name: "team-b"}},
+		&corev1.Namespace{ObjectMeta: metav1.ObjectMeta{Name: "team-c", Labels: map[string]string{"dns": "enabled"}}},
+		service("team-a", "web", map[string]string{"public": "true"}),
+		service("team-a", "internal", nil),
+		service("team-b", "api", map[string]string{"public": "true"}),
+		service("team-c", "shop", map[string]string{"public": "true"}),
+	)
+
+	c := &Controller{
+		client: client,
+		queue:  workqueue.NewRateLimitingQueue(workqueue.DefaultControllerRateLimiter()),
+	}
+	WithNamespaces("team-a", "team-b")(c)
+	WithNamespaceSelector(labels.SelectorFromSet(labels.Set{"dns": "enabled"}))(c)
+	WithServiceSelector(labels.SelectorFromSet(labels.Set{"public": "true"}))(c)
+
+	if err := c.reconcileAllServices(); err != nil {
+		t.Fatalf("reconcileAllServices error: %v", err)
+	}
+
+	var keys []string
+	for c.queue.Len() > 0 {
+		item, _ := c.queue.Get()
+		keys = append(keys, item.(queueItem).key)
+		c.queue.Done(item)
+	}
+	sort.Strings(keys)
+	if len(keys) != 1 || keys[0] != "team-a/web" {
+		t.Errorf("expected only team-a/web to be enqueued, got %v", keys)
+	}
+}
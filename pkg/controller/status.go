@@ -0,0 +1,175 @@
+package controller
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"strings"
+	"sync"
+
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/types"
+	"k8s.io/client-go/kubernetes"
+	"k8s.io/client-go/kubernetes/scheme"
+	typedcorev1 "k8s.io/client-go/kubernetes/typed/core/v1"
+	"k8s.io/client-go/tools/record"
+	"k8s.io/klog/v2"
+)
+
+// The annotation key the controller writes the publication status of a
+// service to, when enabled with WithStatusAnnotation
+const annotationStatus = "upstashternal-dns.alpha.kubernetes.io/status"
+
+// Reasons of the events recorded on services
+const (
+	reasonPublished       = "Published"
+	reasonConflict        = "Conflict"
+	reasonInvalidHostname = "InvalidHostname"
+	reasonNotAllowed      = "HostnameNotAllowed"
+	reasonRedisError      = "RedisError"
+	reasonSyncFailed      = "SyncFailed"
+	reasonFailoverIgnored = "FailoverIgnored"
+)
+
+// errInvalidHostname is returned when a resource has no valid hostname to publish
+var errInvalidHostname = errors.New("invalid hostname")
+
+// redisError marks errors returned by Redis, as opposed to problems with the
+// resource being published
+type redisError struct{ err error }
+
+func (e redisError) Error() string { return e.err.Error() }
+func (e redisError) Unwrap() error { return e.err }
+
+// serviceStatus is the value of the status annotation
+type serviceStatus struct {
+	Hostnames []string `json:"hostnames"`
+	Endpoints int      `json:"endpoints"`
+}
+
+// WithStatusAnnotation enables writing the published hostnames and endpoint
+// count of each service to its status annotation
+func WithStatusAnnotation(enabled bool) Option {
+	return func(c *Controller) {
+		c.statusAnnotation = enabled
+	}
+}
+
+// newRecorder creates an event recorder writing to the Kubernetes API
+func newRecorder(client kubernetes.Interface) record.EventRecorder {
+	broadcaster := record.NewBroadcaster()
+	broadcaster.StartRecordingToSink(&typedcorev1.EventSinkImpl{Interface: client.CoreV1().Events("")})
+	return broadcaster.NewRecorder(scheme.Scheme, corev1.EventSource{Component: "upstashternal-dns"})
+}
+
+// serviceEvent returns the event describing the result of syncing a service.
+// No event is returned when nothing is published.
+func serviceEvent(status serviceStatus, err error) (eventType, reason, message string) {
+	var redisErr redisError
+	switch {
+	case err == nil:
+		if len(status.Hostnames) == 0 {
+			return "", "", ""
+		}
+		return corev1.EventTypeNormal, reasonPublished, fmt.Sprintf("Published %s with %d endpoints", strings.Join(status.Hostnames, ", "), status.Endpoints)
+	case errors.Is(err, errConflict):
+		return corev1.EventTypeWarning, reasonConflict, err.Error()
+	case errors.Is(err, errInvalidHostname):
+		return corev1.EventTypeWarning, reasonInvalidHostname, err.Error()
+	case errors.Is(err, errHostnameNotAllowed):
+		return corev1.EventTypeWarning, reasonNotAllowed, err.Error()
+	case errors.As(err, &redisErr):
+		return corev1.EventTypeWarning, reasonRedisError, err.Error()
+	}
+	return corev1.EventTypeWarning, reasonSyncFailed, err.Error()
+}
+
+// reportService records an event on a service for the result of syncing it,
+// and writes its status annotation when enabled. Periodic reconciliation
+// syncs every service again, so an event is only recorded when it differs
+// from the last one.
+func (c *Controller) reportService(service *corev1.Service, status serviceStatus, err error) {
+	key := ownerKey(SourceService, service.Namespace, service.Name)
+	if eventType, reason, message := serviceEvent(status, err); eventType != "" && c.recorder != nil && c.events.changed(key, reason+": "+message) {
+		c.recorder.Event(service, eventType, reason, message)
+	}
+
+	if err == nil && c.statusAnnotation {
+		if err := c.writeStatus(service, status); err != nil {
+			klog.Errorf("Error writing status of service %s/%s: %v", service.Namespace, service.Name, err)
+		}
+	}
+}
+
+// warnService records a warning event on a service about a problem that does
+// not stop it from being published, once until the warning changes
+func (c *Controller) warnService(service *corev1.Service, reason, message string) {
+	key := ownerKey(SourceService, service.Namespace, service.Name) + "/" + reason
+	if !c.events.changed(key, message) {
+		return
+	}
+	klog.Warningf("Service %s/%s: %s", service.Namespace, service.Name, message)
+	if c.recorder != nil {
+		c.recorder.Event(service, corev1.EventTypeWarning, reason, message)
+	}
+}
+
+// writeStatus patches the status annotation of a service when it changed
+func (c *Controller) writeStatus(service *corev1.Service, status serviceStatus) error {
+	if status.Hostnames == nil {
+		status.Hostnames = []string{}
+	}
+	value, err := json.Marshal(status)
+	if err != nil {
+		return err
+	}
+	if service.Annotations[annotationStatus] == string(value) {
+		return nil
+	}
+
+	patch, err := json.Marshal(map[string]interface{}{
+		"metadata": map[string]interface{}{
+			"annotations": map[string]string{c.annotationKey(annotationStatus): string(value)},
+		},
+	})
+	if err != nil {
+		return err
+	}
+	_, err = c.client.CoreV1().Services(service.Namespace).Patch(context.TODO(), service.Name, types.MergePatchType, patch, metav1.PatchOptions{})
+	return err
+}
+
+// eventLog remembers the last event recorded for each resource. The zero
+// value is ready to use.
+type eventLog struct {
+	mu   sync.Mutex
+	last map[string]string
+}
+
+// changed records event as the last one of key, and reports whether it
+// differs from the previous one
+func (l *eventLog) changed(key, event string) bool {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	if l.last == nil {
+		l.last = make(map[string]string)
+	}
+	if l.last[key] == event {
+		return false
+	}
+	l.last[key] = event
+	return true
+}
+
+// forget drops the last events of a deleted resource
+func (l *eventLog) forget(key string) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	for last := range l.last {
+		if last == key || strings.HasPrefix(last, key+"/") {
+			delete(l.last, last)
+		}
+	}
+}
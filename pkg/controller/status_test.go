@@ -0,0 +1,161 @@
+package controller
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"reflect"
+	"strings"
+	"testing"
+
+	corev1 "k8s.io/api/core/v1"
+	discoveryv1 "k8s.io/api/discovery/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/client-go/kubernetes/fake"
+	"k8s.io/client-go/tools/record"
+)
+
+func TestReportService(t *testing.T) {
+	svc := &corev1.Service{
+		ObjectMeta: metav1.ObjectMeta{
+			Name:      "web",
+			Namespace: "default",
+			Annotations: map[string]string{
+				annotationEnabled:  "true",
+				annotationHostname: "web.example.com",
+			},
+		},
+	}
+	slice := &discoveryv1.EndpointSlice{
+		ObjectMeta: metav1.ObjectMeta{
+			Name:      "web-abc12",
+			Namespace: "default",
+			Labels:    map[string]string{discoveryv1.LabelServiceName: "web"},
+		},
+		AddressType: discoveryv1.AddressTypeIPv4,
+		Endpoints: []discoveryv1.Endpoint{
+			{Addresses: []string{"10.0.0.1"}},
+			{Addresses: []string{"10.0.0.2"}},
+		},
+	}
+	client := fake.NewSimpleClientset(svc, slice)
+	fakeRedis := newFakeRedis()
+	recorder := record.NewFakeRecorder(10)
+	c := &Controller{
+		client:           client,
+		redis:            fakeRedis,
+		published:        newPublishedSet(),
+		recorder:         recorder,
+		statusAnnotation: true,
+	}
+
+	// Periodic syncs of an unchanged service record a single event
+	for i := 0; i < 2; i++ {
+		if err := c.syncService("default/web"); err != nil {
+			t.Fatalf("syncService error: %v", err)
+		}
+	}
+	if got := len(recorder.Events); got != 1 {
+		t.Fatalf("expected 1 event, got %d", got)
+	}
+	if event := <-recorder.Events; !strings.HasPrefix(event, "Normal Published Published web.example.com with 2 endpoints") {
+		t.Errorf("unexpected event %q", event)
+	}
+
+	updated, err := client.CoreV1().Services("default").Get(context.TODO(), "web", metav1.GetOptions{})
+	if err != nil {
+		t.Fatalf("error fetching service: %v", err)
+	}
+	var status serviceStatus
+	if err := json.Unmarshal([]byte(updated.Annotations[annotationStatus]), &status); err != nil {
+		t.Fatalf("invalid status annotation %q: %v", updated.Annotations[annotationStatus], err)
+	}
+	expected := serviceStatus{Hostnames: []string{"web.example.com"}, Endpoints: 2}
+	if !reflect.DeepEqual(status, expected) {
+		t.Errorf("expected status %+v, got %+v", expected, status)
+	}
+
+	// A hostname taken by another resource is reported as a conflict
+	fakeRedis.records["web.example.com"].Metadata["owner"] = "ingress/default/web"
+	if err := c.syncService("default/web"); !errors.Is(err, errConflict) {
+		t.Fatalf("expected a conflict, got %v", err)
+	}
+	if event := <-recorder.Events; !strings.HasPrefix(event, "Warning Conflict ") {
+		t.Errorf("unexpected event %q", event)
+	}
+}
+
+func TestServiceEvent(t *testing.T) {
+	tests := []struct {
+		err    error
+		reason string
+	}{
+		{err: nil, reason: reasonPublished},
+		{err: errConflict, reason: reasonConflict},
+		{err: errInvalidHostname, reason: reasonInvalidHostname},
+		{err: errHostnameNotAllowed, reason: reasonNotAllowed},
+		{err: redisError{errors.New("connection refused")}, reason: reasonRedisError},
+		{err: errors.New("invalid weight"), reason: reasonSyncFailed},
+	}
+
+	for _, tc := range tests {
+		_, reason, _ := serviceEvent(serviceStatus{Hostnames: []string{"web.example.com"}}, tc.err)
+		if reason != tc.reason {
+			t.Errorf("%v: expected reason %s, got %s", tc.err, tc.reason, reason)
+		}
+	}
+
+	if eventType, _, _ := serviceEvent(serviceStatus{}, nil); eventType != "" {
+		t.Errorf("expected no event without published hostnames, got %s", eventType)
+	}
+}
+
+func TestFailoverIgnoredWithoutCluster(t *testing.T) {
+	svc := &corev1.Service{
+		ObjectMeta: metav1.ObjectMeta{
+			Name:      "web",
+			Namespace: "default",
+			Annotations: map[string]string{
+				annotationEnabled:         "true",
+				annotationHostname:        "web.example.com",
+				annotationFailoverPrimary: "east",
+			},
+		},
+	}
+	slice := &discoveryv1.EndpointSlice{
+		ObjectMeta: metav1.ObjectMeta{
+			Name:      "web-abc12",
+			Namespace: "default",
+			Labels:    map[string]string{discoveryv1.LabelServiceName: "web"},
+		},
+		AddressType: discoveryv1.AddressTypeIPv4,
+		Endpoints:   []discoveryv1.Endpoint{{Addresses: []string{"10.0.0.1"}}},
+	}
+	fakeRedis := newFakeRedis()
+	recorder := record.NewFakeRecorder(10)
+	c := &Controller{
+		client:    fake.NewSimpleClientset(svc, slice),
+		redis:     fakeRedis,
+		published: newPublishedSet(),
+		recorder:  recorder,
+	}
+
+	for i := 0; i < 2; i++ {
+		if err := c.syncService("default/web"); err != nil {
+			t.Fatalf("syncService error: %v", err)
+		}
+	}
+	if policy := fakeRedis.records["web.example.com"].Policy; policy != nil {
+		t.Errorf("expected no failover policy without a cluster name, got %+v", policy)
+	}
+
+	var warnings int
+	for len(recorder.Events) > 0 {
+		if event := <-recorder.Events; strings.HasPrefix(event, "Warning FailoverIgnored ") {
+			warnings++
+		}
+	}
+	if warnings != 1 {
+		t.Errorf("expected 1 FailoverIgnored event, got %d", warnings)
+	}
+}
@@ -0,0 +1,82 @@
+package coredns
+
+import "time"
+
+// RecordCluster tracks a cluster publishing endpoints for a record
+type RecordCluster struct {
+	Heartbeat time.Time `json:"heartbeat"`
+	UpdatedAt time.Time `json:"updated_at"`
+}
+
+// RecordPolicy serves the endpoints of the primary cluster while it is
+// healthy, and those of the secondary clusters otherwise
+type RecordPolicy struct {
+	Primary     string   `json:"primary"`
+	Secondaries []string `json:"secondaries,omitempty"`
+	// StaleAfter is how many seconds a cluster may go without a heartbeat
+	StaleAfter int `json:"stale_after,omitempty"`
+}
+
+// defaultStaleAfter applies to policies without a StaleAfter
+const defaultStaleAfter = 30 * time.Second
+
+// staleRecordAfter is how long the endpoints of a record may go without an
+// update before answers from it are counted as stale. The controller updates
+// its records every few seconds, so older ones hold the last known IPs kept
+// by the keep empty policy, or outlived the controller that published them.
+const staleRecordAfter = 30 * time.Second
+
+// staleRecord reports whether the endpoints of a record were not updated
+// recently. Records without an update time are never stale.
+func staleRecord(record *RedisRecord, now time.Time) bool {
+	return !record.UpdatedAt.IsZero() && now.Sub(record.UpdatedAt) > staleRecordAfter
+}
+
+// failoverEndpoints returns the endpoints of a record to answer with under its
+// failover policy. The primary cluster is used while healthy, then the first
+// healthy secondary in order, or every other healthy cluster when no
+// secondaries are listed. When no cluster is healthy, all endpoints are kept
+// rather than answering with nothing, and stale is true.
+func failoverEndpoints(record *RedisRecord, now time.Time) (endpoints []RecordEndpoint, stale bool) {
+	policy := record.Policy
+	if policy == nil || policy.Primary == "" {
+		return record.Endpoints, false
+	}
+
+	staleAfter := defaultStaleAfter
+	if policy.StaleAfter > 0 {
+		staleAfter = time.Duration(policy.StaleAfter) * time.Second
+	}
+
+	byCluster := make(map[string][]RecordEndpoint)
+	for _, endpoint := range record.Endpoints {
+		byCluster[endpoint.Cluster] = append(byCluster[endpoint.Cluster], endpoint)
+	}
+	healthy := func(cluster string) bool {
+		state, ok := record.Clusters[cluster]
+		return ok && now.Sub(state.Heartbeat) <= staleAfter && len(byCluster[cluster]) > 0
+	}
+
+	if healthy(policy.Primary) {
+		return byCluster[policy.Primary], false
+	}
+
+	if len(policy.Secondaries) > 0 {
+		for _, cluster := range policy.Secondaries {
+			if healthy(cluster) {
+				return byCluster[cluster], false
+			}
+		}
+		return record.Endpoints, true
+	}
+
+	for _, endpoint := range record.Endpoints {
+		if endpoint.Cluster != policy.Primary && healthy(endpoint.Cluster) {
+			endpoints = append(endpoints, endpoint)
+		}
+	}
+	if len(endpoints) == 0 {
+		return record.Endpoints, true
+	}
+	return endpoints, false
+}
@@ -0,0 +1,86 @@
+package coredns
+
+import (
+	"reflect"
+	"testing"
+	"time"
+)
+
+func TestFailoverEndpoints(t *testing.T) {
+	now := time.Now()
+	fresh := RecordCluster{Heartbeat: now.Add(-5 * time.Second)}
+	stale := RecordCluster{Heartbeat: now.Add(-time.Minute)}
+	endpoints := []RecordEndpoint{
+		{IP: "10.0.0.1", Cluster: "east"},
+		{IP: "10.1.0.1", Cluster: "west"},
+		{IP: "10.2.0.1", Cluster: "central"},
+	}
+
+	tests := []struct {
+		name        string
+		clusters    map[string]RecordCluster
+		secondaries []string
+		expected    []string
+		stale       bool
+	}{
+		{
+			name:     "healthy primary",
+			clusters: map[string]RecordCluster{"east": fresh, "west": fresh, "central": fresh},
+			expected: []string{"10.0.0.1"},
+		},
+		{
+			name:     "stale primary fails over to every healthy cluster",
+			clusters: map[string]RecordCluster{"east": stale, "west": fresh, "central": stale},
+			expected: []string{"10.1.0.1"},
+		},
+		{
+			name:        "secondaries in order",
+			clusters:    map[string]RecordCluster{"east": stale, "west": fresh, "central": fresh},
+			secondaries: []string{"central", "west"},
+			expected:    []string{"10.2.0.1"},
+		},
+		{
+			name:     "nothing healthy",
+			clusters: map[string]RecordCluster{"east": stale, "west": stale, "central": stale},
+			expected: []string{"10.0.0.1", "10.1.0.1", "10.2.0.1"},
+			stale:    true,
+		},
+	}
+
+	for _, tc := range tests {
+		record := &RedisRecord{
+			Endpoints: endpoints,
+			Clusters:  tc.clusters,
+			Policy:    &RecordPolicy{Primary: "east", Secondaries: tc.secondaries, StaleAfter: 30},
+		}
+
+		var got []string
+		endpoints, stale := failoverEndpoints(record, now)
+		for _, endpoint := range endpoints {
+			got = append(got, endpoint.IP)
+		}
+		if !reflect.DeepEqual(got, tc.expected) {
+			t.Errorf("%s: expected %v, got %v", tc.name, tc.expected, got)
+		}
+		if stale != tc.stale {
+			t.Errorf("%s: expected stale %t, got %t", tc.name, tc.stale, stale)
+		}
+	}
+}
+
+func TestStaleRecord(t *testing.T) {
+	now := time.Now()
+	tests := []struct {
+		updatedAt time.Time
+		stale     bool
+	}{
+		{updatedAt: time.Time{}, stale: false},
+		{updatedAt: now.Add(-5 * time.Second), stale: false},
+		{updatedAt: now.Add(-time.Minute), stale: true},
+	}
+	for _, tc := range tests {
+		if got := staleRecord(&RedisRecord{UpdatedAt: tc.updatedAt}, now); got != tc.stale {
+			t.Errorf("updated at %v: expected stale %v, got %v", tc.updatedAt, tc.stale, got)
+		}
+	}
+}
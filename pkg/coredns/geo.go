@@ -0,0 +1,128 @@
+package coredns
+
+import (
+	"net"
+
+	"github.com/coredns/coredns/request"
+	"github.com/miekg/dns"
+)
+
+// clientSubnet returns the EDNS0 Client Subnet option of a query, if any
+func clientSubnet(msg *dns.Msg) *dns.EDNS0_SUBNET {
+	opt := msg.IsEdns0()
+	if opt == nil {
+		return nil
+	}
+	for _, option := range opt.Option {
+		if subnet, ok := option.(*dns.EDNS0_SUBNET); ok {
+			return subnet
+		}
+	}
+	return nil
+}
+
+// clientIP returns the address answers are tailored to: the client subnet a
+// resolver forwarded with EDNS0 Client Subnet, or else the source address of
+// the query. A source prefix of zero asks not to use the client subnet.
+func clientIP(state request.Request) net.IP {
+	if subnet := clientSubnet(state.Req); subnet != nil && subnet.SourceNetmask > 0 {
+		return subnet.Address
+	}
+	return net.ParseIP(state.IP())
+}
+
+// clientRegion returns the region of the querying client from the configured
+// region subnets
+func (r *Redis) clientRegion(state request.Request) string {
+	region, _ := r.regions.lookup(clientIP(state))
+	return region
+}
+
+// regionEndpoints returns the endpoints published from region. When none
+// are, every endpoint is returned so that farther regions still answer.
+func regionEndpoints(endpoints []RecordEndpoint, region string) []RecordEndpoint {
+	if region == "" {
+		return endpoints
+	}
+
+	var local []RecordEndpoint
+	for _, endpoint := range endpoints {
+		if endpoint.Region == region {
+			local = append(local, endpoint)
+		}
+	}
+	if len(local) == 0 {
+		return endpoints
+	}
+	return local
+}
+
+// scope returns how many leading bits of ip the label it maps to depends on,
+// for the scope prefix of an EDNS0 Client Subnet answer. Addresses matching
+// no subnet, or a subnet with more specific subnets inside it, are scoped to
+// the source prefix the resolver sent.
+func (m subnetMap) scope(ip net.IP, source uint8) uint8 {
+	if len(m) == 0 {
+		return 0
+	}
+
+	for i, entry := range m {
+		if !entry.subnet.Contains(ip) {
+			continue
+		}
+		ones, _ := entry.subnet.Mask.Size()
+		// Entries are sorted most specific first, so nested subnets come earlier
+		for _, nested := range m[:i] {
+			if entry.subnet.Contains(nested.subnet.IP) {
+				return source
+			}
+		}
+		return uint8(ones)
+	}
+	return source
+}
+
+// subnetScope returns the scope prefix of an answer to the client subnet,
+// which covers every subnet table answers depend on
+func (r *Redis) subnetScope(subnet *dns.EDNS0_SUBNET) uint8 {
+	scope := r.regions.scope(subnet.Address, subnet.SourceNetmask)
+	if zoneScope := r.topology.scope(subnet.Address, subnet.SourceNetmask); zoneScope > scope {
+		scope = zoneScope
+	}
+	return scope
+}
+
+// echoSubnet adds the client subnet of the query to the OPT record of the
+// reply, with the scope prefix the answer is valid for
+func (r *Redis) echoSubnet(subnet *dns.EDNS0_SUBNET, m *dns.Msg) {
+	opt := m.IsEdns0()
+	if subnet == nil || opt == nil {
+		return
+	}
+
+	var scope uint8
+	if subnet.SourceNetmask > 0 {
+		scope = r.subnetScope(subnet)
+	}
+
+	// SizeAndDo reuses the OPT record of the query for the reply, so the reply
+	// gets a copy of its own to leave the query as the client sent it
+	reply := &dns.OPT{Hdr: opt.Hdr}
+	for _, option := range opt.Option {
+		if option.Option() != dns.EDNS0SUBNET {
+			reply.Option = append(reply.Option, option)
+		}
+	}
+	reply.Option = append(reply.Option, &dns.EDNS0_SUBNET{
+		Code:          dns.EDNS0SUBNET,
+		Family:        subnet.Family,
+		SourceNetmask: subnet.SourceNetmask,
+		SourceScope:   scope,
+		Address:       subnet.Address,
+	})
+	for i, rr := range m.Extra {
+		if rr == opt {
+			m.Extra[i] = reply
+		}
+	}
+}
@@ -0,0 +1,114 @@
+package coredns
+
+import (
+	"net"
+	"reflect"
+	"testing"
+
+	"github.com/coredns/coredns/plugin/test"
+	"github.com/coredns/coredns/request"
+	"github.com/miekg/dns"
+)
+
+func TestRegionEndpoints(t *testing.T) {
+	endpoints := []RecordEndpoint{
+		{IP: "10.0.0.1", Region: "us-east-1"},
+		{IP: "10.1.0.1", Region: "eu-west-1"},
+	}
+
+	tests := []struct {
+		region   string
+		expected []string
+	}{
+		{region: "", expected: []string{"10.0.0.1", "10.1.0.1"}},
+		{region: "eu-west-1", expected: []string{"10.1.0.1"}},
+		{region: "ap-south-1", expected: []string{"10.0.0.1", "10.1.0.1"}},
+	}
+
+	for _, tc := range tests {
+		var got []string
+		for _, endpoint := range regionEndpoints(endpoints, tc.region) {
+			got = append(got, endpoint.IP)
+		}
+		if !reflect.DeepEqual(got, tc.expected) {
+			t.Errorf("region %q: expected %v, got %v", tc.region, tc.expected, got)
+		}
+	}
+}
+
+func TestSubnetScope(t *testing.T) {
+	var m subnetMap
+	for cidr, label := range map[string]string{
+		"198.51.100.0/24":  "us-east-1",
+		"203.0.113.0/24":   "eu-west-1",
+		"203.0.113.128/26": "eu-central-1",
+	} {
+		if err := m.add(cidr, label); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	tests := []struct {
+		ip       string
+		expected uint8
+	}{
+		{ip: "198.51.100.7", expected: 24},
+		{ip: "203.0.113.130", expected: 26},
+		// eu-west-1 has a more specific subnet inside it
+		{ip: "203.0.113.7", expected: 20},
+		{ip: "192.0.2.1", expected: 20},
+	}
+
+	for _, tc := range tests {
+		if got := m.scope(net.ParseIP(tc.ip), 20); got != tc.expected {
+			t.Errorf("%s: expected scope %d, got %d", tc.ip, tc.expected, got)
+		}
+	}
+
+	if got := (subnetMap{}).scope(net.ParseIP("192.0.2.1"), 24); got != 0 {
+		t.Errorf("expected scope 0 without subnets, got %d", got)
+	}
+}
+
+func TestEchoSubnet(t *testing.T) {
+	r := &Redis{}
+	if err := r.regions.add("198.51.100.0/24", "us-east-1"); err != nil {
+		t.Fatal(err)
+	}
+
+	req := new(dns.Msg)
+	req.SetQuestion("web.example.com.", dns.TypeA)
+	req.SetEdns0(4096, false)
+	opt := req.IsEdns0()
+	opt.Option = append(opt.Option, &dns.EDNS0_SUBNET{
+		Code:          dns.EDNS0SUBNET,
+		Family:        1,
+		SourceNetmask: 24,
+		Address:       net.ParseIP("198.51.100.0").To4(),
+	})
+	state := request.Request{W: &test.ResponseWriter{}, Req: req}
+
+	if got := r.clientRegion(state); got != "us-east-1" {
+		t.Errorf("expected region us-east-1 from the client subnet, got %q", got)
+	}
+
+	m := new(dns.Msg)
+	m.SetReply(req)
+	query := clientSubnet(req)
+	state.SizeAndDo(m)
+	r.echoSubnet(query, m)
+
+	subnet := clientSubnet(m)
+	if subnet == nil {
+		t.Fatal("expected the client subnet to be echoed")
+	}
+	if subnet.SourceNetmask != 24 || subnet.SourceScope != 24 {
+		t.Errorf("expected source and scope prefix 24, got %d and %d", subnet.SourceNetmask, subnet.SourceScope)
+	}
+
+	// SizeAndDo already strips the subnet from the OPT record it shares with
+	// the query, which must not get the one of the reply
+	if subnet := clientSubnet(req); subnet != nil {
+		t.Errorf("expected the client subnet of the reply not to be added to the query, got %v", subnet)
+	}
+}
@@ -0,0 +1,68 @@
+package coredns
+
+import (
+	"context"
+	"fmt"
+	"sort"
+	"sync"
+
+	"github.com/coredns/coredns/plugin/metadata"
+	"github.com/coredns/coredns/request"
+	"k8s.io/klog/v2"
+)
+
+// metadataKeys lists the record metadata exposed to other plugins, as
+// upstashternal/<key> labels of the metadata plugin
+var metadataKeys = []string{"namespace", "service", "ingress", "route", "dnsendpoint", "owner"}
+
+// Metadata implements metadata.Provider, so plugins such as log and rewrite
+// can use the metadata of the record a query resolves to. The record is only
+// fetched when a label is read.
+func (r *Redis) Metadata(ctx context.Context, state request.Request) context.Context {
+	qname := state.Name()
+
+	var once sync.Once
+	var record *RedisRecord
+	lookup := func() *RedisRecord {
+		once.Do(func() {
+			var err error
+			if record, err = r.findRecord(qname); err != nil {
+				klog.Errorf("Error querying Redis metadata for %s: %v", qname, err)
+			}
+		})
+		return record
+	}
+
+	for _, key := range metadataKeys {
+		key := key
+		metadata.SetValueFunc(ctx, r.Name()+"/"+key, func() string {
+			if record := lookup(); record != nil {
+				return record.Metadata[key]
+			}
+			return ""
+		})
+	}
+	return ctx
+}
+
+// metadataAnswers returns the metadata of a record as key=value TXT records.
+// Names with a CNAME cannot hold other data, so aliases expose none and TXT
+// queries follow the CNAME instead.
+func metadataAnswers(name string, record *RedisRecord) []string {
+	if len(record.Targets["CNAME"]) > 0 {
+		return nil
+	}
+
+	keys := make([]string, 0, len(record.Metadata))
+	for key := range record.Metadata {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+
+	answers := make([]string, 0, len(keys))
+	for _, key := range keys {
+		txt := fmt.Sprintf("%s=%s", key, record.Metadata[key])
+		answers = append(answers, fmt.Sprintf("%s %d IN TXT %s", name, record.TTL, quoteTXT(txt)))
+	}
+	return answers
+}
@@ -0,0 +1,40 @@
+package coredns
+
+import (
+	"reflect"
+	"testing"
+
+	"github.com/miekg/dns"
+)
+
+func TestMetadataAnswers(t *testing.T) {
+	record := &RedisRecord{
+		TTL: 10,
+		Metadata: RecordMetadata{
+			"service":   "web",
+			"namespace": "default",
+		},
+	}
+
+	expected := []string{
+		"web.example.com.\t10\tIN\tTXT\t\"namespace=default\"",
+		"web.example.com.\t10\tIN\tTXT\t\"service=web\"",
+	}
+
+	var got []string
+	for _, answer := range metadataAnswers("web.example.com.", record) {
+		rr, err := dns.NewRR(answer)
+		if err != nil {
+			t.Fatalf("invalid record %q: %v", answer, err)
+		}
+		got = append(got, rr.String())
+	}
+	if !reflect.DeepEqual(got, expected) {
+		t.Errorf("expected %v, got %v", expected, got)
+	}
+
+	record.Targets = map[string][]string{"CNAME": {"web.example.net"}}
+	if answers := metadataAnswers("web.example.com.", record); len(answers) != 0 {
+		t.Errorf("expected no metadata for an alias, got %v", answers)
+	}
+}
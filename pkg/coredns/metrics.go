@@ -0,0 +1,70 @@
+package coredns
+
+import (
+	"context"
+
+	"github.com/coredns/coredns/core/dnsserver"
+	"github.com/coredns/coredns/plugin"
+	"github.com/coredns/coredns/request"
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/promauto"
+)
+
+// Results of a query, as recorded by requestCount
+const (
+	// resultHit is a query answered from Redis
+	resultHit = "hit"
+	// resultMiss is a query in a configured zone answered with NXDOMAIN or NODATA
+	resultMiss = "miss"
+	// resultFallthrough is a query passed on to the next plugin
+	resultFallthrough = "fallthrough"
+	// resultError is a query that failed on a Redis error
+	resultError = "error"
+)
+
+var (
+	requestCount = promauto.NewCounterVec(prometheus.CounterOpts{
+		Namespace: plugin.Namespace,
+		Subsystem: "upstashternal",
+		Name:      "requests_total",
+		Help:      "Counter of queries handled, by zone, type and result.",
+	}, []string{"server", "zone", "type", "result"})
+
+	lookupDuration = promauto.NewHistogram(prometheus.HistogramOpts{
+		Namespace: plugin.Namespace,
+		Subsystem: "upstashternal",
+		Name:      "redis_lookup_duration_seconds",
+		Help:      "Histogram of the time each Redis lookup took.",
+		Buckets:   plugin.TimeBuckets,
+	})
+
+	staleAnswers = promauto.NewCounterVec(prometheus.CounterOpts{
+		Namespace: plugin.Namespace,
+		Subsystem: "upstashternal",
+		Name:      "stale_answers_total",
+		Help:      "Counter of answers served from stale records: records not updated for over 30s, or failed over without a healthy cluster.",
+	}, []string{"server", "zone"})
+)
+
+// count records the result of a query
+func (r *Redis) count(ctx context.Context, state request.Request, zone, result string) {
+	requestCount.WithLabelValues(server(ctx), metricsZone(zone), state.Type(), result).Inc()
+}
+
+// metricsZone returns the zone label of a query, "." outside the configured zones
+func metricsZone(zone string) string {
+	if zone == "" {
+		return "."
+	}
+	return zone
+}
+
+// server returns the address of the server handling a query, as the metrics
+// plugin labels it. plugin/metrics is not imported to keep promhttp out of the
+// plugin's dependencies.
+func server(ctx context.Context) string {
+	if srv, ok := ctx.Value(dnsserver.Key{}).(*dnsserver.Server); ok {
+		return srv.Addr
+	}
+	return ""
+}
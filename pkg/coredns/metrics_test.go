@@ -0,0 +1,28 @@
+package coredns
+
+import (
+	"context"
+	"testing"
+
+	"github.com/coredns/coredns/plugin/test"
+	"github.com/coredns/coredns/request"
+	"github.com/miekg/dns"
+	"github.com/prometheus/client_golang/prometheus/testutil"
+)
+
+func TestCount(t *testing.T) {
+	r := &Redis{}
+	msg := new(dns.Msg)
+	msg.SetQuestion("app.example.com.", dns.TypeA)
+	state := request.Request{W: &test.ResponseWriter{}, Req: msg}
+
+	r.count(context.Background(), state, "example.com.", resultHit)
+	r.count(context.Background(), state, "", resultFallthrough)
+
+	if got := testutil.ToFloat64(requestCount.WithLabelValues("", "example.com.", "A", resultHit)); got != 1 {
+		t.Errorf("expected 1 hit in example.com., got %v", got)
+	}
+	if got := testutil.ToFloat64(requestCount.WithLabelValues("", ".", "A", resultFallthrough)); got != 1 {
+		t.Errorf("expected 1 fallthrough outside the zones, got %v", got)
+	}
+}
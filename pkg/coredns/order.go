@@ -0,0 +1,46 @@
+package coredns
+
+import (
+	"math/rand"
+)
+
+// Orderings of the addresses in an answer
+const (
+	// orderStable answers in the order the addresses are stored
+	orderStable = "stable"
+	// orderRandom shuffles the addresses for every query
+	orderRandom = "random"
+	// orderRoundRobin rotates the addresses by one position per query
+	orderRoundRobin = "round_robin"
+)
+
+// validOrder reports whether order names a supported ordering
+func validOrder(order string) bool {
+	switch order {
+	case orderStable, orderRandom, orderRoundRobin:
+		return true
+	}
+	return false
+}
+
+// orderAnswers reorders the answers of a query according to the configured
+// ordering. The slice is reordered in place.
+func (r *Redis) orderAnswers(answers []string) []string {
+	if len(answers) < 2 {
+		return answers
+	}
+
+	switch r.Order {
+	case orderRandom:
+		rand.Shuffle(len(answers), func(i, j int) {
+			answers[i], answers[j] = answers[j], answers[i]
+		})
+	case orderRoundRobin:
+		shift := int(r.queries.Add(1) % uint64(len(answers)))
+		rotated := make([]string, 0, len(answers))
+		rotated = append(rotated, answers[shift:]...)
+		rotated = append(rotated, answers[:shift]...)
+		return rotated
+	}
+	return answers
+}
@@ -0,0 +1,35 @@
+package coredns
+
+import (
+	"reflect"
+	"sort"
+	"testing"
+)
+
+func TestOrderAnswers(t *testing.T) {
+	answers := []string{"a", "b", "c"}
+
+	stable := &Redis{Order: orderStable}
+	if got := stable.orderAnswers(append([]string(nil), answers...)); !reflect.DeepEqual(got, answers) {
+		t.Errorf("stable: expected %v, got %v", answers, got)
+	}
+
+	roundRobin := &Redis{Order: orderRoundRobin}
+	expected := [][]string{
+		{"b", "c", "a"},
+		{"c", "a", "b"},
+		{"a", "b", "c"},
+	}
+	for i, want := range expected {
+		if got := roundRobin.orderAnswers(append([]string(nil), answers...)); !reflect.DeepEqual(got, want) {
+			t.Errorf("round_robin query %d: expected %v, got %v", i, want, got)
+		}
+	}
+
+	random := &Redis{Order: orderRandom}
+	got := random.orderAnswers(append([]string(nil), answers...))
+	sort.Strings(got)
+	if !reflect.DeepEqual(got, answers) {
+		t.Errorf("random: expected a permutation of %v, got %v", answers, got)
+	}
+}
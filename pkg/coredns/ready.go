@@ -0,0 +1,48 @@
+package coredns
+
+import (
+	"context"
+	"time"
+
+	"k8s.io/klog/v2"
+)
+
+// pingInterval is how often Redis connectivity is checked for readiness
+const pingInterval = 5 * time.Second
+
+// pingTimeout bounds a single Redis connectivity check
+const pingTimeout = 5 * time.Second
+
+// Ready implements the ready plugin's Readiness interface: the plugin is ready
+// while the last Redis ping succeeded
+func (r *Redis) Ready() bool { return r.ready.Load() }
+
+// ping checks that Redis is reachable and records the result for Ready
+func (r *Redis) ping(ctx context.Context) {
+	ctx, cancel := context.WithTimeout(ctx, pingTimeout)
+	defer cancel()
+
+	err := r.client.Ping(ctx).Err()
+	if ready := err == nil; r.ready.Swap(ready) != ready {
+		if ready {
+			klog.Info("Redis is reachable")
+		} else {
+			klog.Errorf("Redis is unreachable: %v", err)
+		}
+	}
+}
+
+// watchHealth pings Redis every pingInterval until ctx is done
+func (r *Redis) watchHealth(ctx context.Context) {
+	ticker := time.NewTicker(pingInterval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+			r.ping(ctx)
+		}
+	}
+}
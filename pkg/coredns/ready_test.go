@@ -0,0 +1,19 @@
+package coredns
+
+import (
+	"context"
+	"testing"
+
+	"github.com/redis/go-redis/v9"
+)
+
+func TestReadyUnreachable(t *testing.T) {
+	r := &Redis{client: redis.NewClient(&redis.Options{Addr: "127.0.0.1:1", MaxRetries: -1})}
+	defer r.client.Close()
+
+	r.ready.Store(true)
+	r.ping(context.Background())
+	if r.Ready() {
+		t.Error("expected not ready while Redis is unreachable")
+	}
+}
@@ -5,7 +5,10 @@ import (
 	"crypto/tls"
 	"encoding/json"
 	"fmt"
+	"net"
 	"os"
+	"strings"
+	"sync/atomic"
 	"time"
 
 	"github.com/coredns/coredns/plugin"
@@ -13,28 +16,78 @@ import (
 	"github.com/joho/godotenv"
 	"github.com/miekg/dns"
 	"github.com/redis/go-redis/v9"
+	"github.com/upstash/redis-external-dns/pkg/dnskey"
 	"k8s.io/klog/v2"
 )
 
+// maxCNAMEChain limits how many CNAMEs are followed within Redis for a query
+const maxCNAMEChain = 8
+
+// supportedTypes lists the query types answered from Redis
+var supportedTypes = map[uint16]bool{
+	dns.TypeA:     true,
+	dns.TypeAAAA:  true,
+	dns.TypeCNAME: true,
+	dns.TypeTXT:   true,
+	dns.TypeSRV:   true,
+}
+
 type Redis struct {
 	Next          plugin.Handler
 	RedisAddress  string
 	RedisPassword string
 	TTL           uint32
-	client        *redis.Client
+	// MaxAnswers limits the number of addresses in an answer, 0 means no limit
+	MaxAnswers int
+	// Order is the ordering of the addresses in an answer: stable, random or
+	// round_robin. Weighted records are always shuffled by weight.
+	Order string
+	// ExposeMetadata answers TXT queries with the record metadata as
+	// key=value strings, after any TXT content the record declares
+	ExposeMetadata bool
+	// Zones are the zones the plugin is authoritative for, served by zone
+	// transfers under a synthesized SOA naming the first of Nameservers
+	Zones       plugin.Zones
+	Nameservers []string
+	// ReverseZones are the in-addr.arpa and ip6.arpa zones PTR queries are
+	// answered in
+	ReverseZones plugin.Zones
+	client       *redis.Client
+	topology     subnetMap
+	regions      subnetMap
+	queries      atomic.Uint64
+	// ready is set while Redis is reachable
+	ready atomic.Bool
 }
 
 type RedisRecord struct {
-	IPs      []string       `json:"ips"`
-	TTL      int            `json:"ttl"`
-	Metadata RecordMetadata `json:"metadata"`
+	IPs      []string            `json:"ips"`
+	TTL      int                 `json:"ttl"`
+	Metadata RecordMetadata      `json:"metadata"`
+	Targets  map[string][]string `json:"targets,omitempty"`
+	// Endpoints describes where each of the IPs runs
+	Endpoints []RecordEndpoint `json:"endpoints,omitempty"`
+	// Clusters tracks the clusters publishing endpoints for the record
+	Clusters map[string]RecordCluster `json:"clusters,omitempty"`
+	Policy   *RecordPolicy            `json:"policy,omitempty"`
+	// UpdatedAt is when the controller last wrote the record
+	UpdatedAt time.Time `json:"updated_at"`
 }
 
-type RecordMetadata struct {
-	Namespace string `json:"namespace"`
-	Service   string `json:"service"`
+type RecordEndpoint struct {
+	IP      string   `json:"ip"`
+	Zone    string   `json:"zone,omitempty"`
+	Node    string   `json:"node,omitempty"`
+	Cluster string   `json:"cluster,omitempty"`
+	Region  string   `json:"region,omitempty"`
+	Weight  int      `json:"weight,omitempty"`
+	Hints   []string `json:"hints,omitempty"`
 }
 
+// RecordMetadata describes the resource that published a record, such as its
+// namespace, service and owner
+type RecordMetadata map[string]string
+
 func NewRedisInstance() *Redis {
 	if err := godotenv.Load("../../.env.test"); err != nil {
 		klog.Warningf("Warning: .env.test file not found, using environment variables")
@@ -54,6 +107,7 @@ func NewRedisInstance() *Redis {
 		RedisAddress:  addr,
 		RedisPassword: password,
 		TTL:           3600,
+		Order:         orderStable,
 	}
 
 	// Initialize Redis connection
@@ -64,12 +118,11 @@ func NewRedisInstance() *Redis {
 		DB:        0,
 	})
 
-	// Test the connection
-	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
-	defer cancel()
-
-	if err := r.client.Ping(ctx).Err(); err != nil {
-		klog.Fatalf("Failed to connect to Redis: %v", err)
+	// Test the connection; the plugin reports not ready until Redis is
+	// reachable rather than failing to start
+	r.ping(context.Background())
+	if !r.Ready() {
+		klog.Warningf("Failed to connect to Redis at %s, retrying every %s", r.RedisAddress, pingInterval)
 	}
 
 	return r
@@ -78,21 +131,50 @@ func NewRedisInstance() *Redis {
 func (r *Redis) ServeDNS(ctx context.Context, w dns.ResponseWriter, msg *dns.Msg) (int, error) {
 	state := request.Request{W: w, Req: msg}
 
-	// Only handle A record queries
-	if state.QType() != dns.TypeA {
-		klog.V(2).Infof("Skipping non-A record query for %s", state.Name())
+	// Within the configured zones every answer comes from Redis, including
+	// denial of existence, so the dnssec plugin can sign it
+	zone := r.Zones.Matches(strings.ToLower(state.Name()))
+	if zone != "" && state.Name() == zone && (state.QType() == dns.TypeSOA || state.QType() == dns.TypeNS) {
+		r.count(ctx, state, zone, resultHit)
+		return r.serveApex(ctx, w, state, zone)
+	}
+
+	// Only handle the record types stored in Redis
+	reverse := r.isReverse(state)
+	if !supportedTypes[state.QType()] && !reverse {
+		if zone != "" {
+			r.count(ctx, state, zone, resultMiss)
+			return r.serveDenial(ctx, w, state, zone)
+		}
+		klog.V(2).Infof("Skipping %s query for %s", state.Type(), state.Name())
+		r.count(ctx, state, zone, resultFallthrough)
 		return plugin.NextOrFailure(r.Name(), r.Next, ctx, w, msg)
 	}
 
 	qname := state.Name()
-	records, err := r.queryRedis(qname)
+	var records []string
+	var err error
+	if reverse {
+		records, err = r.queryReverse(state)
+	} else {
+		records, err = r.queryRedis(ctx, state, zone)
+	}
 	if err != nil {
 		klog.Errorf("Error querying Redis for %s: %v", qname, err)
+		r.count(ctx, state, zone, resultError)
+		if zone != "" {
+			return dns.RcodeServerFailure, err
+		}
 		return plugin.NextOrFailure(r.Name(), r.Next, ctx, w, msg)
 	}
 
 	if len(records) == 0 {
 		klog.V(2).Infof("No records found for %s", qname)
+		if zone != "" && !reverse {
+			r.count(ctx, state, zone, resultMiss)
+			return r.serveDenial(ctx, w, state, zone)
+		}
+		r.count(ctx, state, zone, resultFallthrough)
 		return plugin.NextOrFailure(r.Name(), r.Next, ctx, w, msg)
 	}
 
@@ -112,47 +194,197 @@ func (r *Redis) ServeDNS(ctx context.Context, w dns.ResponseWriter, msg *dns.Msg
 
 	if len(m.Answer) == 0 {
 		klog.Warningf("Failed to create any valid DNS records for %s", qname)
+		r.count(ctx, state, zone, resultFallthrough)
 		return plugin.NextOrFailure(r.Name(), r.Next, ctx, w, msg)
 	}
 
-	klog.V(2).Infof("Returning %d answers for %s", len(m.Answer), qname)
+	// The client subnet is read first as SizeAndDo drops it from the OPT record
+	subnet := clientSubnet(msg)
+	// Make the reply fit the client's buffer; UDP clients get the TC bit and
+	// retry over TCP when a name has too many addresses
+	state.SizeAndDo(m)
+	r.echoSubnet(subnet, m)
+	m = state.Scrub(m)
+
+	klog.V(2).Infof("Returning %d answers for %s (truncated: %t)", len(m.Answer), qname, m.Truncated)
+	r.count(ctx, state, zone, resultHit)
 	w.WriteMsg(m)
 	return dns.RcodeSuccess, nil
 }
 
 func (r *Redis) Name() string { return "upstashternal" }
 
-func (r *Redis) queryRedis(qname string) ([]string, error) {
-	klog.Infof("Querying Redis for %s", qname)
-	key := fmt.Sprintf("dns:%s", qname)
-	klog.Infof("Redis key: %s", key)
+func (r *Redis) queryRedis(ctx context.Context, state request.Request, zone string) ([]string, error) {
+	qname, qtype := state.Name(), state.QType()
+	klog.Infof("Querying Redis for %s %s", qname, dns.TypeToString[qtype])
 
-	val, err := r.client.Get(context.Background(), key).Result()
-	if err != nil {
-		if err == redis.Nil {
-			klog.V(2).Infof("No DNS record found for %s", qname)
-			return nil, nil
+	var records []string
+	var stale bool
+	name := qname
+	for i := 0; i <= maxCNAMEChain; i++ {
+		record, err := r.findRecord(name)
+		if err != nil {
+			return nil, err
+		}
+
+		if record == nil {
+			klog.V(2).Infof("No DNS record found for %s", name)
+			break
+		}
+
+		stale = stale || staleRecord(record, time.Now())
+		shuffled := false
+		if qtype == dns.TypeA || qtype == dns.TypeAAAA {
+			if record.Policy != nil {
+				var failedOver bool
+				record.Endpoints, failedOver = failoverEndpoints(record, time.Now())
+				stale = stale || failedOver
+			}
+			record.Endpoints = regionEndpoints(record.Endpoints, r.clientRegion(state))
+			record.IPs, shuffled = topologyIPs(record, r.clientZone(state))
+		}
+
+		answers := recordAnswers(name, qtype, record)
+		if qtype == dns.TypeTXT && r.ExposeMetadata {
+			answers = append(answers, metadataAnswers(name, record)...)
+		}
+		if qtype == dns.TypeA || qtype == dns.TypeAAAA {
+			// Answers shuffled by weight are ordered already
+			if !shuffled {
+				answers = r.orderAnswers(answers)
+			}
+			if r.MaxAnswers > 0 && len(answers) > r.MaxAnswers {
+				answers = answers[:r.MaxAnswers]
+			}
 		}
+		if len(answers) > 0 || qtype == dns.TypeCNAME {
+			records = append(records, answers...)
+			break
+		}
+
+		// Answer with the CNAME of a name without data of the queried type,
+		// and follow it in case the target is stored in Redis too
+		cname := record.Targets["CNAME"]
+		if len(cname) == 0 {
+			klog.V(2).Infof("No %s data found in record for %s", dns.TypeToString[qtype], name)
+			break
+		}
+		target := dns.Fqdn(cname[0])
+		records = append(records, fmt.Sprintf("%s %d IN CNAME %s", name, record.TTL, target))
+		name = target
+	}
+
+	if stale && len(records) > 0 {
+		staleAnswers.WithLabelValues(server(ctx), metricsZone(zone)).Inc()
+	}
+	klog.V(2).Infof("Found %d records for %s", len(records), qname)
+	return records, nil
+}
+
+// clientZone returns the zone of the querying client from the configured
+// topology subnets
+func (r *Redis) clientZone(state request.Request) string {
+	zone, _ := r.topology.lookup(clientIP(state))
+	return zone
+}
+
+// recordAnswers returns the resource records of the given type held by a
+// record, in presentation format
+func recordAnswers(name string, qtype uint16, record *RedisRecord) []string {
+	var answers []string
+	switch qtype {
+	case dns.TypeA, dns.TypeAAAA:
+		// IPs holds both address families
+		for _, ip := range record.IPs {
+			parsed := net.ParseIP(ip)
+			if parsed == nil || (parsed.To4() != nil) != (qtype == dns.TypeA) {
+				continue
+			}
+			answers = append(answers, fmt.Sprintf("%s %d IN %s %s", name, record.TTL, dns.TypeToString[qtype], ip))
+		}
+	case dns.TypeCNAME:
+		for _, target := range record.Targets["CNAME"] {
+			answers = append(answers, fmt.Sprintf("%s %d IN CNAME %s", name, record.TTL, dns.Fqdn(target)))
+		}
+	case dns.TypeTXT:
+		for _, txt := range record.Targets["TXT"] {
+			answers = append(answers, fmt.Sprintf("%s %d IN TXT %s", name, record.TTL, quoteTXT(txt)))
+		}
+	default:
+		rrType := dns.TypeToString[qtype]
+		for _, target := range record.Targets[rrType] {
+			answers = append(answers, fmt.Sprintf("%s %d IN %s %s", name, record.TTL, rrType, target))
+		}
+	}
+	return answers
+}
+
+// quoteTXT turns TXT record content into quoted character strings, split at
+// the 255 byte limit of a single string
+func quoteTXT(txt string) string {
+	escape := strings.NewReplacer(`\`, `\\`, `"`, `\"`)
+
+	var parts []string
+	for len(txt) > 255 {
+		parts = append(parts, `"`+escape.Replace(txt[:255])+`"`)
+		txt = txt[255:]
+	}
+	parts = append(parts, `"`+escape.Replace(txt)+`"`)
+	return strings.Join(parts, " ")
+}
+
+// findRecord fetches the record stored for qname. When no exact key exists the
+// wildcard record with the longest matching suffix is returned instead.
+func (r *Redis) findRecord(qname string) (*RedisRecord, error) {
+	names := append([]string{qname}, wildcardNames(qname)...)
+	keys := make([]string, 0, len(names))
+	for _, name := range names {
+		keys = append(keys, dnskey.Record(name))
+	}
+	klog.Infof("Redis keys: %v", keys)
+
+	// Fetch the exact and wildcard keys in a single round trip
+	start := time.Now()
+	vals, err := r.client.MGet(context.Background(), keys...).Result()
+	lookupDuration.Observe(time.Since(start).Seconds())
+	if err != nil {
 		klog.Errorf("Redis query error for %s: %v", qname, err)
 		return nil, fmt.Errorf("redis query error: %w", err)
 	}
 
-	var record RedisRecord
-	if err := json.Unmarshal([]byte(val), &record); err != nil {
-		klog.Errorf("Failed to parse Redis record for %s: %v", qname, err)
-		return nil, fmt.Errorf("invalid record format: %w", err)
-	}
+	for i, val := range vals {
+		data, ok := val.(string)
+		if !ok {
+			continue
+		}
+
+		var record RedisRecord
+		if err := json.Unmarshal([]byte(data), &record); err != nil {
+			klog.Errorf("Failed to parse Redis record for %s: %v", names[i], err)
+			return nil, fmt.Errorf("invalid record format: %w", err)
+		}
 
-	if len(record.IPs) == 0 {
-		klog.V(2).Infof("No IPs found in record for %s", qname)
-		return nil, nil
+		if i > 0 {
+			klog.V(2).Infof("Matched wildcard record %s for %s", names[i], qname)
+		}
+		return &record, nil
 	}
 
-	var records []string
-	for _, ip := range record.IPs {
-		records = append(records, fmt.Sprintf("%s %d IN A %s", qname, record.TTL, ip))
+	return nil, nil
+}
+
+// wildcardNames returns the wildcard names that could cover qname, ordered from
+// the longest suffix to the shortest. For a.b.example.com. that is
+// *.b.example.com., *.example.com. and *.com.
+func wildcardNames(qname string) []string {
+	labels := dns.SplitDomainName(qname)
+	if len(labels) < 2 {
+		return nil
 	}
 
-	klog.V(2).Infof("Found %d IPs for %s", len(records), qname)
-	return records, nil
+	names := make([]string, 0, len(labels)-1)
+	for i := 1; i < len(labels); i++ {
+		names = append(names, dns.Fqdn("*."+strings.Join(labels[i:], ".")))
+	}
+	return names
 }
@@ -3,12 +3,16 @@ package coredns
 import (
 	"context"
 	"fmt"
+	"reflect"
 	"testing"
+	"time"
 
 	"github.com/coredns/coredns/plugin"
 	"github.com/coredns/coredns/plugin/pkg/dnstest"
 	"github.com/coredns/coredns/plugin/test"
 	"github.com/miekg/dns"
+	goredis "github.com/redis/go-redis/v9"
+	"github.com/upstash/redis-external-dns/pkg/dnskey"
 )
 
 func TestRedis(t *testing.T) {
@@ -52,3 +56,139 @@ func TestRedis(t *testing.T) {
 		}
 	}
 }
+
+func TestWildcardNames(t *testing.T) {
+	tests := []struct {
+		qname    string
+		expected []string
+	}{
+		{
+			qname:    "a.b.example.com.",
+			expected: []string{"*.b.example.com.", "*.example.com.", "*.com."},
+		},
+		{
+			qname:    "example.com.",
+			expected: []string{"*.com."},
+		},
+		{
+			qname:    "com.",
+			expected: nil,
+		},
+	}
+
+	for _, tc := range tests {
+		got := wildcardNames(tc.qname)
+		if !reflect.DeepEqual(got, tc.expected) {
+			t.Errorf("%s: expected %v, got %v", tc.qname, tc.expected, got)
+		}
+	}
+}
+
+func TestRecordAnswers(t *testing.T) {
+	record := &RedisRecord{
+		IPs: []string{"192.168.1.1", "2001:db8::1"},
+		TTL: 10,
+		Targets: map[string][]string{
+			"CNAME": {"other.example.com"},
+			"TXT":   {`owner="team-a"`},
+			"SRV":   {"10 5 8080 web.example.com."},
+		},
+	}
+
+	tests := []struct {
+		qtype    uint16
+		expected []string
+	}{
+		{qtype: dns.TypeA, expected: []string{"web.example.com.\t10\tIN\tA\t192.168.1.1"}},
+		{qtype: dns.TypeAAAA, expected: []string{"web.example.com.\t10\tIN\tAAAA\t2001:db8::1"}},
+		{qtype: dns.TypeCNAME, expected: []string{"web.example.com.\t10\tIN\tCNAME\tother.example.com."}},
+		{qtype: dns.TypeTXT, expected: []string{"web.example.com.\t10\tIN\tTXT\t\"owner=\\\"team-a\\\"\""}},
+		{qtype: dns.TypeSRV, expected: []string{"web.example.com.\t10\tIN\tSRV\t10 5 8080 web.example.com."}},
+	}
+
+	for _, tc := range tests {
+		var got []string
+		for _, answer := range recordAnswers("web.example.com.", tc.qtype, record) {
+			rr, err := dns.NewRR(answer)
+			if err != nil {
+				t.Fatalf("%s: invalid record %q: %v", dns.TypeToString[tc.qtype], answer, err)
+			}
+			got = append(got, rr.String())
+		}
+		if !reflect.DeepEqual(got, tc.expected) {
+			t.Errorf("%s: expected %v, got %v", dns.TypeToString[tc.qtype], tc.expected, got)
+		}
+	}
+}
+
+func TestRedisDenial(t *testing.T) {
+	redis := NewRedisInstance()
+	redis.Zones = []string{"upstashternal-dns.com."}
+	redis.Nameservers = []string{"ns1.upstashternal-dns.com."}
+	redis.Next = test.NextHandler(dns.RcodeServerFailure, nil)
+
+	tests := []struct {
+		qname string
+		qtype uint16
+		rcode int
+	}{
+		{qname: "nonexistent.upstashternal-dns.com.", qtype: dns.TypeA, rcode: dns.RcodeNameError},
+		{qname: "upstashternal-dns.com.", qtype: dns.TypeMX, rcode: dns.RcodeSuccess},
+	}
+
+	for _, tc := range tests {
+		m := new(dns.Msg)
+		m.SetQuestion(tc.qname, tc.qtype)
+
+		rec := dnstest.NewRecorder(&test.ResponseWriter{})
+		if _, err := redis.ServeDNS(context.TODO(), rec, m); err != nil {
+			t.Fatalf("%s: expected no error, got %v", tc.qname, err)
+		}
+		if rec.Msg.Rcode != tc.rcode {
+			t.Errorf("%s: expected rcode %d, got %d", tc.qname, tc.rcode, rec.Msg.Rcode)
+		}
+		if len(rec.Msg.Answer) != 0 || len(rec.Msg.Ns) != 1 || rec.Msg.Ns[0].Header().Rrtype != dns.TypeSOA {
+			t.Errorf("%s: expected an empty answer with the SOA, got %v", tc.qname, rec.Msg)
+		}
+	}
+}
+
+func TestRedisEmptyNonTerminal(t *testing.T) {
+	redis := NewRedisInstance()
+	redis.Zones = []string{"upstashternal-dns.com."}
+	redis.Nameservers = []string{"ns1.upstashternal-dns.com."}
+	redis.Next = test.NextHandler(dns.RcodeServerFailure, nil)
+
+	ctx := context.TODO()
+	key := dnskey.Record("_http._tcp.upstashternal-dns.com")
+	if err := redis.client.Set(ctx, key, `{"ips":[],"ttl":10,"targets":{"SRV":["0 0 80 web.upstashternal-dns.com."]}}`, time.Minute).Err(); err != nil {
+		t.Fatalf("Error storing record: %v", err)
+	}
+	defer redis.client.Del(ctx, key)
+	index := dnskey.Subtree("_tcp.upstashternal-dns.com")
+	if err := redis.client.ZAdd(ctx, index, goredis.Z{Score: float64(time.Now().Add(time.Minute).Unix()), Member: "_http._tcp.upstashternal-dns.com."}).Err(); err != nil {
+		t.Fatalf("Error indexing record: %v", err)
+	}
+	defer redis.client.Del(ctx, index)
+
+	tests := []struct {
+		qname string
+		rcode int
+	}{
+		{qname: "_tcp.upstashternal-dns.com.", rcode: dns.RcodeSuccess},
+		{qname: "_udp.upstashternal-dns.com.", rcode: dns.RcodeNameError},
+	}
+
+	for _, tc := range tests {
+		m := new(dns.Msg)
+		m.SetQuestion(tc.qname, dns.TypeA)
+
+		rec := dnstest.NewRecorder(&test.ResponseWriter{})
+		if _, err := redis.ServeDNS(ctx, rec, m); err != nil {
+			t.Fatalf("%s: expected no error, got %v", tc.qname, err)
+		}
+		if rec.Msg.Rcode != tc.rcode {
+			t.Errorf("%s: expected rcode %d, got %d", tc.qname, tc.rcode, rec.Msg.Rcode)
+		}
+	}
+}
@@ -0,0 +1,102 @@
+package coredns
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"net"
+	"strconv"
+	"time"
+
+	"github.com/coredns/coredns/plugin/pkg/dnsutil"
+	"github.com/coredns/coredns/request"
+	"github.com/miekg/dns"
+	"github.com/redis/go-redis/v9"
+	"github.com/upstash/redis-external-dns/pkg/dnskey"
+	"k8s.io/klog/v2"
+)
+
+// isReverse reports whether a PTR query falls in one of the configured
+// reverse zones
+func (r *Redis) isReverse(state request.Request) bool {
+	return state.QType() == dns.TypePTR && len(r.ReverseZones) > 0 && r.ReverseZones.Matches(state.Name()) != ""
+}
+
+// queryReverse answers a PTR query with the hostnames published for the IP
+func (r *Redis) queryReverse(state request.Request) ([]string, error) {
+	qname := state.Name()
+	ip := net.ParseIP(dnsutil.ExtractAddressFromReverse(qname))
+	if ip == nil {
+		klog.V(2).Infof("No address in reverse name %s", qname)
+		return nil, nil
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+
+	// Both lookups count as one
+	start := time.Now()
+	defer func() { lookupDuration.Observe(time.Since(start).Seconds()) }()
+	now := start.Unix()
+	members, err := r.client.ZRangeByScoreWithScores(ctx, dnskey.Reverse(ip), &redis.ZRangeBy{
+		Min: "(" + strconv.FormatInt(now, 10),
+		Max: "+inf",
+	}).Result()
+	if err != nil {
+		return nil, err
+	}
+
+	var hostnames, keys []string
+	var expiries []int64
+	for _, member := range members {
+		hostname, ok := member.Member.(string)
+		if !ok {
+			continue
+		}
+		hostnames = append(hostnames, hostname)
+		keys = append(keys, dnskey.Record(hostname))
+		expiries = append(expiries, int64(member.Score))
+	}
+	if len(keys) == 0 {
+		klog.V(2).Infof("No PTR records for %s", ip)
+		return nil, nil
+	}
+
+	// The index entries outlive short record TTLs, so the answers are capped
+	// at the TTL of the forward records, fetched in a single round trip
+	vals, err := r.client.MGet(ctx, keys...).Result()
+	if err != nil {
+		return nil, err
+	}
+
+	var records []string
+	for i, val := range vals {
+		var forward *RedisRecord
+		if data, ok := val.(string); ok {
+			forward = &RedisRecord{}
+			if err := json.Unmarshal([]byte(data), forward); err != nil {
+				klog.Errorf("Failed to parse Redis record for %s: %v", hostnames[i], err)
+				continue
+			}
+		}
+		ttl, ok := ptrTTL(expiries[i]-now, forward)
+		if !ok {
+			continue
+		}
+		records = append(records, fmt.Sprintf("%s %d IN PTR %s", qname, ttl, dns.Fqdn(hostnames[i])))
+	}
+
+	klog.V(2).Infof("Found %d PTR records for %s", len(records), ip)
+	return records, nil
+}
+
+// ptrTTL returns the TTL of a PTR answer for a forward record whose reverse
+// index entry expires in remaining seconds: the TTL of the record, but no
+// longer than the entry lasts. Entries whose forward record is gone are not
+// answered.
+func ptrTTL(remaining int64, record *RedisRecord) (int64, bool) {
+	if record == nil {
+		return 0, false
+	}
+	return min(remaining, int64(record.TTL)), true
+}
@@ -0,0 +1,23 @@
+package coredns
+
+import "testing"
+
+func TestPtrTTL(t *testing.T) {
+	tests := []struct {
+		remaining int64
+		record    *RedisRecord
+		expected  int64
+		ok        bool
+	}{
+		{remaining: 30, record: &RedisRecord{TTL: 10}, expected: 10, ok: true},
+		{remaining: 5, record: &RedisRecord{TTL: 10}, expected: 5, ok: true},
+		{remaining: 30, record: nil, ok: false},
+	}
+
+	for _, tc := range tests {
+		ttl, ok := ptrTTL(tc.remaining, tc.record)
+		if ttl != tc.expected || ok != tc.ok {
+			t.Errorf("remaining %d, record %+v: expected (%d, %v), got (%d, %v)", tc.remaining, tc.record, tc.expected, tc.ok, ttl, ok)
+		}
+	}
+}
@@ -1,9 +1,16 @@
 package coredns
 
 import (
+	"context"
+	"strconv"
+	"strings"
+
 	"github.com/coredns/caddy"
 	"github.com/coredns/coredns/core/dnsserver"
 	"github.com/coredns/coredns/plugin"
+	"github.com/coredns/coredns/plugin/pkg/dnsutil"
+	"github.com/coredns/coredns/plugin/transfer"
+	"github.com/miekg/dns"
 )
 
 func init() {
@@ -12,16 +19,141 @@ func init() {
 
 func setup(c *caddy.Controller) error {
 	redis := NewRedisInstance()
+	if err := parse(c, redis); err != nil {
+		return plugin.Error("upstashternal", err)
+	}
 
 	dnsserver.GetConfig(c).AddPlugin(func(next plugin.Handler) plugin.Handler {
 		redis.Next = next
 		return redis
 	})
 
+	// Keep checking Redis for the ready plugin, and notify secondaries
+	// through the transfer plugin when records change
+	ctx, cancel := context.WithCancel(context.Background())
+	c.OnStartup(func() error {
+		go redis.watchHealth(ctx)
+		if t, ok := dnsserver.GetConfig(c).Handler("transfer").(*transfer.Transfer); ok && len(redis.Zones) > 0 {
+			go redis.watchChanges(ctx, t)
+		}
+		return nil
+	})
+
 	// Add cleanup on shutdown
 	c.OnShutdown(func() error {
+		cancel()
 		return redis.client.Close()
 	})
 
 	return nil
 }
+
+// parse reads the plugin configuration from the Corefile:
+//
+//	upstashternal {
+//	    topology CIDR ZONE
+//	    region CIDR REGION
+//	    max_answers NUMBER
+//	    order stable|random|round_robin
+//	    reverse ZONE|CIDR...
+//	    expose_metadata
+//	    zones ZONE...
+//	    nameservers NAME...
+//	}
+func parse(c *caddy.Controller, r *Redis) error {
+	for c.Next() {
+		args := c.RemainingArgs()
+		// An empty block written as "upstashternal {}" is read as one argument
+		if len(args) == 1 && args[0] == "{}" {
+			args = nil
+		}
+		if len(args) > 0 {
+			return c.ArgErr()
+		}
+
+		for c.NextBlock() {
+			switch c.Val() {
+			case "topology":
+				args := c.RemainingArgs()
+				if len(args) != 2 {
+					return c.ArgErr()
+				}
+				if err := r.topology.add(args[0], args[1]); err != nil {
+					return c.Err(err.Error())
+				}
+			case "region":
+				args := c.RemainingArgs()
+				if len(args) != 2 {
+					return c.ArgErr()
+				}
+				if err := r.regions.add(args[0], args[1]); err != nil {
+					return c.Err(err.Error())
+				}
+			case "max_answers":
+				args := c.RemainingArgs()
+				if len(args) != 1 {
+					return c.ArgErr()
+				}
+				n, err := strconv.Atoi(args[0])
+				if err != nil || n < 1 {
+					return c.Errf("invalid max_answers %q", args[0])
+				}
+				r.MaxAnswers = n
+			case "order":
+				args := c.RemainingArgs()
+				if len(args) != 1 {
+					return c.ArgErr()
+				}
+				if !validOrder(args[0]) {
+					return c.Errf("invalid order %q", args[0])
+				}
+				r.Order = args[0]
+			case "expose_metadata":
+				if len(c.RemainingArgs()) != 0 {
+					return c.ArgErr()
+				}
+				r.ExposeMetadata = true
+			case "zones":
+				args := c.RemainingArgs()
+				if len(args) == 0 {
+					return c.ArgErr()
+				}
+				for _, arg := range args {
+					r.Zones = append(r.Zones, plugin.Host(arg).NormalizeExact()...)
+				}
+			case "nameservers":
+				args := c.RemainingArgs()
+				if len(args) == 0 {
+					return c.ArgErr()
+				}
+				for _, arg := range args {
+					r.Nameservers = append(r.Nameservers, strings.ToLower(dns.Fqdn(arg)))
+				}
+			case "reverse":
+				args := c.RemainingArgs()
+				if len(args) == 0 {
+					return c.ArgErr()
+				}
+				for _, arg := range args {
+					zones := plugin.Host(arg).NormalizeExact()
+					if len(zones) == 0 {
+						return c.Errf("invalid reverse zone %q", arg)
+					}
+					for _, zone := range zones {
+						if dnsutil.IsReverse(zone) == 0 {
+							return c.Errf("%q is not a reverse zone", arg)
+						}
+						r.ReverseZones = append(r.ReverseZones, zone)
+					}
+				}
+			default:
+				return c.Errf("unknown property %q", c.Val())
+			}
+		}
+	}
+
+	if len(r.Zones) > 0 && len(r.Nameservers) == 0 {
+		return c.Err("zones require nameservers")
+	}
+	return nil
+}
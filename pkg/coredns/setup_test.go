@@ -0,0 +1,103 @@
+package coredns
+
+import (
+	"net"
+	"testing"
+
+	"github.com/coredns/caddy"
+)
+
+func TestParse(t *testing.T) {
+	tests := []struct {
+		input      string
+		shouldErr  bool
+		maxAnswers int
+		order      string
+		zones      map[string]string
+		reverse    []string
+	}{
+		{input: `upstashternal`},
+		{input: `upstashternal {}`},
+		{
+			input: `upstashternal {
+				topology 10.0.0.0/16 us-east-1a
+				topology 10.0.1.0/24 us-east-1b
+				max_answers 3
+			}`,
+			maxAnswers: 3,
+			zones: map[string]string{
+				"10.0.0.10": "us-east-1a",
+				"10.0.1.10": "us-east-1b",
+			},
+		},
+		{
+			input: `upstashternal {
+				order round_robin
+			}`,
+			order: orderRoundRobin,
+		},
+		{
+			input: `upstashternal {
+				reverse 10.0.0.0/8 1.0.0.0.ip6.arpa
+			}`,
+			reverse: []string{"10.in-addr.arpa.", "1.0.0.0.ip6.arpa."},
+		},
+		{input: `upstashternal extra`, shouldErr: true},
+		{input: `upstashternal {
+			zones example.com
+		}`, shouldErr: true},
+		{input: `upstashternal {
+			reverse example.com
+		}`, shouldErr: true},
+		{input: `upstashternal {
+			order alphabetical
+		}`, shouldErr: true},
+		{input: `upstashternal {
+			topology 10.0.0.0/33 us-east-1a
+		}`, shouldErr: true},
+		{input: `upstashternal {
+			max_answers 0
+		}`, shouldErr: true},
+		{input: `upstashternal {
+			region 198.51.100.0/24
+		}`, shouldErr: true},
+		{input: `upstashternal {
+			unknown
+		}`, shouldErr: true},
+	}
+
+	for _, tc := range tests {
+		c := caddy.NewTestController("dns", tc.input)
+		r := &Redis{}
+		err := parse(c, r)
+		if tc.shouldErr {
+			if err == nil {
+				t.Errorf("%q: expected error", tc.input)
+			}
+			continue
+		}
+		if err != nil {
+			t.Errorf("%q: unexpected error: %v", tc.input, err)
+			continue
+		}
+		if r.MaxAnswers != tc.maxAnswers {
+			t.Errorf("%q: expected max_answers %d, got %d", tc.input, tc.maxAnswers, r.MaxAnswers)
+		}
+		if r.Order != tc.order {
+			t.Errorf("%q: expected order %q, got %q", tc.input, tc.order, r.Order)
+		}
+		if len(r.ReverseZones) != len(tc.reverse) {
+			t.Errorf("%q: expected reverse zones %v, got %v", tc.input, tc.reverse, r.ReverseZones)
+		}
+		for i := range tc.reverse {
+			if i < len(r.ReverseZones) && r.ReverseZones[i] != tc.reverse[i] {
+				t.Errorf("%q: expected reverse zones %v, got %v", tc.input, tc.reverse, r.ReverseZones)
+			}
+		}
+		for ip, zone := range tc.zones {
+			if got, _ := r.topology.lookup(net.ParseIP(ip)); got != zone {
+				t.Errorf("%q: expected zone %s for %s, got %s", tc.input, zone, ip, got)
+			}
+		}
+	}
+}
@@ -0,0 +1,141 @@
+package coredns
+
+import (
+	"fmt"
+	"math"
+	"math/rand"
+	"net"
+	"sort"
+)
+
+// subnetMap maps client subnets to labels such as zones. Lookups return the
+// label of the most specific subnet containing the address.
+type subnetMap []subnetEntry
+
+type subnetEntry struct {
+	subnet *net.IPNet
+	label  string
+}
+
+// add maps the subnet in CIDR notation to label
+func (m *subnetMap) add(cidr, label string) error {
+	_, subnet, err := net.ParseCIDR(cidr)
+	if err != nil {
+		return fmt.Errorf("invalid subnet %q: %w", cidr, err)
+	}
+
+	*m = append(*m, subnetEntry{subnet: subnet, label: label})
+
+	// Keep the most specific subnets first so the first match wins
+	sort.SliceStable(*m, func(i, j int) bool {
+		oi, _ := (*m)[i].subnet.Mask.Size()
+		oj, _ := (*m)[j].subnet.Mask.Size()
+		return oi > oj
+	})
+	return nil
+}
+
+// lookup returns the label of the most specific subnet containing ip
+func (m subnetMap) lookup(ip net.IP) (string, bool) {
+	if ip == nil {
+		return "", false
+	}
+	for _, entry := range m {
+		if entry.subnet.Contains(ip) {
+			return entry.label, true
+		}
+	}
+	return "", false
+}
+
+// topologyIPs returns the IPs of a record to answer a client in zone with.
+// Endpoints hinted for the zone, or else located in it, are preferred over
+// the others, which are only used when no endpoint matches. Weighted
+// endpoints are shuffled so that each leads the answer in proportion to its
+// weight. Records without endpoint metadata answer with their IPs as stored.
+// It reports whether the IPs were shuffled by weight, in which case they must
+// not be reordered.
+func topologyIPs(record *RedisRecord, zone string) ([]string, bool) {
+	if len(record.Endpoints) == 0 {
+		return record.IPs, false
+	}
+
+	candidates := record.Endpoints
+	if zone != "" {
+		if local := zoneEndpoints(candidates, zone); len(local) > 0 {
+			candidates = local
+		}
+	}
+
+	shuffled := weighted(candidates)
+	if shuffled {
+		candidates = weightedShuffle(candidates)
+	}
+
+	ips := make([]string, 0, len(candidates))
+	for _, endpoint := range candidates {
+		ips = append(ips, endpoint.IP)
+	}
+	return ips, shuffled
+}
+
+// zoneEndpoints returns the endpoints hinted for zone. Without hints for the
+// zone, the endpoints located in it are returned instead.
+func zoneEndpoints(endpoints []RecordEndpoint, zone string) []RecordEndpoint {
+	var hinted, local []RecordEndpoint
+	for _, endpoint := range endpoints {
+		for _, hint := range endpoint.Hints {
+			if hint == zone {
+				hinted = append(hinted, endpoint)
+				break
+			}
+		}
+		if endpoint.Zone == zone {
+			local = append(local, endpoint)
+		}
+	}
+
+	if len(hinted) > 0 {
+		return hinted
+	}
+	return local
+}
+
+// weight returns the weight of an endpoint, where an unset weight counts as 1
+func (e RecordEndpoint) weight() int {
+	if e.Weight < 1 {
+		return 1
+	}
+	return e.Weight
+}
+
+// weighted reports whether the endpoints carry different weights
+func weighted(endpoints []RecordEndpoint) bool {
+	for _, endpoint := range endpoints[1:] {
+		if endpoint.weight() != endpoints[0].weight() {
+			return true
+		}
+	}
+	return false
+}
+
+// weightedShuffle returns the endpoints in a random order where heavier
+// endpoints are more likely to come first
+func weightedShuffle(endpoints []RecordEndpoint) []RecordEndpoint {
+	keys := make([]float64, len(endpoints))
+	order := make([]int, len(endpoints))
+	for i, endpoint := range endpoints {
+		// Weighted random sampling keys (Efraimidis-Spirakis), smallest first
+		keys[i] = -math.Log(1-rand.Float64()) / float64(endpoint.weight())
+		order[i] = i
+	}
+	sort.Slice(order, func(i, j int) bool {
+		return keys[order[i]] < keys[order[j]]
+	})
+
+	shuffled := make([]RecordEndpoint, 0, len(endpoints))
+	for _, i := range order {
+		shuffled = append(shuffled, endpoints[i])
+	}
+	return shuffled
+}
@@ -0,0 +1,78 @@
+package coredns
+
+import (
+	"reflect"
+	"testing"
+)
+
+func TestTopologyIPs(t *testing.T) {
+	record := &RedisRecord{
+		IPs: []string{"10.0.0.1", "10.0.1.1", "10.0.2.1"},
+		Endpoints: []RecordEndpoint{
+			{IP: "10.0.0.1", Zone: "us-east-1a"},
+			{IP: "10.0.1.1", Zone: "us-east-1b", Hints: []string{"us-east-1c"}},
+			{IP: "10.0.2.1", Zone: "us-east-1b"},
+		},
+	}
+
+	tests := []struct {
+		zone     string
+		expected []string
+	}{
+		{zone: "", expected: []string{"10.0.0.1", "10.0.1.1", "10.0.2.1"}},
+		{zone: "us-east-1a", expected: []string{"10.0.0.1"}},
+		{zone: "us-east-1b", expected: []string{"10.0.1.1", "10.0.2.1"}},
+		{zone: "us-east-1c", expected: []string{"10.0.1.1"}},
+		{zone: "eu-west-1a", expected: []string{"10.0.0.1", "10.0.1.1", "10.0.2.1"}},
+	}
+
+	for _, tc := range tests {
+		got, shuffled := topologyIPs(record, tc.zone)
+		if !reflect.DeepEqual(got, tc.expected) {
+			t.Errorf("zone %q: expected %v, got %v", tc.zone, tc.expected, got)
+		}
+		if shuffled {
+			t.Errorf("zone %q: expected unweighted endpoints not to be shuffled", tc.zone)
+		}
+	}
+}
+
+func TestTopologyIPsLocalUnweighted(t *testing.T) {
+	// The record is weighted, but the endpoints of each zone weigh the same
+	record := &RedisRecord{
+		IPs: []string{"10.0.0.1", "10.0.0.2", "10.0.1.1"},
+		Endpoints: []RecordEndpoint{
+			{IP: "10.0.0.1", Zone: "us-east-1a", Weight: 1},
+			{IP: "10.0.0.2", Zone: "us-east-1a", Weight: 1},
+			{IP: "10.0.1.1", Zone: "us-east-1b", Weight: 5},
+		},
+	}
+
+	if _, shuffled := topologyIPs(record, "us-east-1a"); shuffled {
+		t.Error("expected the zone-local endpoints not to be shuffled by weight")
+	}
+	if _, shuffled := topologyIPs(record, ""); !shuffled {
+		t.Error("expected all endpoints to be shuffled by weight")
+	}
+}
+
+func TestWeightedShuffle(t *testing.T) {
+	endpoints := []RecordEndpoint{
+		{IP: "10.0.0.1", Weight: 1},
+		{IP: "10.0.0.2", Weight: 9},
+	}
+
+	first := make(map[string]int)
+	for i := 0; i < 1000; i++ {
+		shuffled := weightedShuffle(endpoints)
+		if len(shuffled) != len(endpoints) {
+			t.Fatalf("expected %d endpoints, got %d", len(endpoints), len(shuffled))
+		}
+		first[shuffled[0].IP]++
+	}
+
+	// The heavier endpoint should lead roughly nine times out of ten
+	if first["10.0.0.2"] < 800 {
+		t.Errorf("expected 10.0.0.2 to lead most answers, got %v", first)
+	}
+}
@@ -0,0 +1,256 @@
+package coredns
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/coredns/coredns/plugin/transfer"
+	"github.com/miekg/dns"
+	"github.com/upstash/redis-external-dns/pkg/dnskey"
+	"k8s.io/klog/v2"
+)
+
+// transferTypes lists the record types included in zone transfers
+var transferTypes = []uint16{dns.TypeA, dns.TypeAAAA, dns.TypeCNAME, dns.TypeTXT, dns.TypeSRV}
+
+// notifyInterval is how long changes are collected before secondaries are
+// notified, so a burst of updates results in one NOTIFY per zone
+const notifyInterval = time.Second
+
+// journalEntry is a change to the records served for a hostname, as written
+// by the controller
+type journalEntry struct {
+	Serial   uint32       `json:"serial"`
+	Hostname string       `json:"hostname"`
+	Before   *RedisRecord `json:"before,omitempty"`
+	After    *RedisRecord `json:"after,omitempty"`
+}
+
+// Transfer implements transfer.Transferer. An AXFR streams every record
+// under the zone; an IXFR streams the changes since the requested serial from
+// the controller's journal, or the whole zone when the journal no longer
+// reaches back that far.
+func (r *Redis) Transfer(zone string, serial uint32) (<-chan []dns.RR, error) {
+	zone, ok := r.authoritative(zone)
+	if !ok {
+		return nil, transfer.ErrNotAuthoritative
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 30*time.Second)
+	defer cancel()
+
+	current, err := r.serial(ctx)
+	if err != nil {
+		return nil, err
+	}
+	soa := r.soa(zone, current)
+
+	var records [][]dns.RR
+	switch {
+	case serial != 0 && !serialBefore(serial, current):
+		// Up to date, answer with the SOA only
+		records = [][]dns.RR{{soa}}
+	case serial != 0:
+		changes, ok, err := r.journalSince(ctx, zone, serial, current)
+		if err != nil {
+			return nil, err
+		}
+		if ok {
+			records = ixfrRecords(soa, r.soa(zone, serial), changes)
+			break
+		}
+		klog.Infof("Journal does not reach serial %d of %s, falling back to AXFR", serial, zone)
+		fallthrough
+	default:
+		rrs, err := r.zoneRecords(ctx, zone)
+		if err != nil {
+			return nil, err
+		}
+		records = [][]dns.RR{append([]dns.RR{soa}, r.nsRecords(zone)...), rrs, {soa}}
+	}
+
+	ch := make(chan []dns.RR)
+	go func() {
+		defer close(ch)
+		for _, rrs := range records {
+			if len(rrs) > 0 {
+				ch <- rrs
+			}
+		}
+	}()
+	return ch, nil
+}
+
+// zoneRecords returns every record stored in Redis under zone
+func (r *Redis) zoneRecords(ctx context.Context, zone string) ([]dns.RR, error) {
+	var keys []string
+	iter := r.client.Scan(ctx, 0, dnskey.Prefix+"*", 1000).Iterator()
+	for iter.Next(ctx) {
+		// Skip keys not yet migrated to the canonical format
+		if dnskey.IsCanonical(iter.Val()) && dns.IsSubDomain(zone, dnskey.Hostname(iter.Val())) {
+			keys = append(keys, iter.Val())
+		}
+	}
+	if err := iter.Err(); err != nil {
+		return nil, fmt.Errorf("redis scan error: %w", err)
+	}
+	sort.Strings(keys)
+
+	var rrs []dns.RR
+	for start := 0; start < len(keys); start += 100 {
+		batch := keys[start:min(start+100, len(keys))]
+		vals, err := r.client.MGet(ctx, batch...).Result()
+		if err != nil {
+			return nil, fmt.Errorf("redis query error: %w", err)
+		}
+		for i, val := range vals {
+			data, ok := val.(string)
+			if !ok {
+				// Expired since the scan
+				continue
+			}
+			var record RedisRecord
+			if err := json.Unmarshal([]byte(data), &record); err != nil {
+				klog.Errorf("Failed to parse Redis record %s: %v", batch[i], err)
+				continue
+			}
+			rrs = append(rrs, transferRecords(dnskey.Hostname(batch[i]), &record)...)
+		}
+	}
+	return rrs, nil
+}
+
+// journalSince returns the changes under zone after serial up to current,
+// oldest first. It reports false when the journal was trimmed past serial.
+func (r *Redis) journalSince(ctx context.Context, zone string, serial, current uint32) ([]journalEntry, bool, error) {
+	values, err := r.client.LRange(ctx, journalKey, 0, -1).Result()
+	if err != nil {
+		return nil, false, err
+	}
+	return journalChanges(values, zone, serial, current)
+}
+
+// journalChanges parses the journal, newest first, into the changes under
+// zone after serial up to current, oldest first. Entries after current were
+// written after the serial was read and are left to the next transfer, since
+// the SOA announces current.
+func journalChanges(values []string, zone string, serial, current uint32) ([]journalEntry, bool, error) {
+	var changes []journalEntry
+	reached := false
+	for _, value := range values {
+		var entry journalEntry
+		if err := json.Unmarshal([]byte(value), &entry); err != nil {
+			return nil, false, fmt.Errorf("invalid journal entry: %w", err)
+		}
+		if serialBefore(current, entry.Serial) {
+			continue
+		}
+		if !serialBefore(serial, entry.Serial) {
+			reached = true
+			break
+		}
+		if entry.Serial == serial+1 {
+			reached = true
+		}
+		if dns.IsSubDomain(zone, dns.Fqdn(entry.Hostname)) {
+			changes = append([]journalEntry{entry}, changes...)
+		}
+	}
+	return changes, reached, nil
+}
+
+// ixfrRecords returns the condensed incremental transfer from the old SOA to
+// the current one: the records to delete, then the records to add
+func ixfrRecords(current, old *dns.SOA, changes []journalEntry) [][]dns.RR {
+	// Only the state before the first change and after the last one matter
+	first := make(map[string]*RedisRecord)
+	last := make(map[string]*RedisRecord)
+	var names []string
+	for _, change := range changes {
+		name := dns.Fqdn(change.Hostname)
+		if _, ok := first[name]; !ok {
+			first[name] = change.Before
+			names = append(names, name)
+		}
+		last[name] = change.After
+	}
+	sort.Strings(names)
+
+	var deleted, added []dns.RR
+	for _, name := range names {
+		deleted = append(deleted, transferRecords(name, first[name])...)
+		added = append(added, transferRecords(name, last[name])...)
+	}
+
+	return [][]dns.RR{{current, old}, deleted, {current}, added, {current}}
+}
+
+// transferRecords returns the resource records of a record, of every type
+// included in zone transfers
+func transferRecords(name string, record *RedisRecord) []dns.RR {
+	if record == nil {
+		return nil
+	}
+
+	var rrs []dns.RR
+	for _, qtype := range transferTypes {
+		for _, answer := range recordAnswers(name, qtype, record) {
+			rr, err := dns.NewRR(answer)
+			if err != nil {
+				klog.Errorf("Error creating DNS record for %s: %v", name, err)
+				continue
+			}
+			rrs = append(rrs, rr)
+		}
+	}
+	return rrs
+}
+
+// serialBefore reports whether serial a precedes b in serial number
+// arithmetic (RFC 1982)
+func serialBefore(a, b uint32) bool {
+	return a != b && int32(b-a) > 0
+}
+
+// notifier sends NOTIFY messages for a zone, as the transfer plugin does
+type notifier interface {
+	Notify(zone string) error
+}
+
+// watchChanges notifies secondaries of the zones changed by the controller
+// until ctx is done. Changes are collected for notifyInterval so each zone is
+// notified at most once per interval.
+func (r *Redis) watchChanges(ctx context.Context, n notifier) {
+	pubsub := r.client.Subscribe(ctx, notifyChannel)
+	defer pubsub.Close()
+
+	ticker := time.NewTicker(notifyInterval)
+	defer ticker.Stop()
+
+	pending := make(map[string]bool)
+	messages := pubsub.Channel()
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case msg, ok := <-messages:
+			if !ok {
+				return
+			}
+			if zone := r.Zones.Matches(strings.ToLower(dns.Fqdn(msg.Payload))); zone != "" {
+				pending[zone] = true
+			}
+		case <-ticker.C:
+			for zone := range pending {
+				if err := n.Notify(zone); err != nil {
+					klog.Errorf("Error notifying secondaries of %s: %v", zone, err)
+				}
+			}
+			pending = make(map[string]bool)
+		}
+	}
+}
@@ -0,0 +1,97 @@
+package coredns
+
+import (
+	"testing"
+
+	"github.com/coredns/coredns/plugin/transfer"
+)
+
+var _ transfer.Transferer = (*Redis)(nil)
+
+func TestTransferNotAuthoritative(t *testing.T) {
+	r := &Redis{Zones: []string{"example.com."}, Nameservers: []string{"ns1.example.net."}}
+	if _, err := r.Transfer("example.org.", 0); err != transfer.ErrNotAuthoritative {
+		t.Errorf("expected ErrNotAuthoritative, got %v", err)
+	}
+	if _, err := r.Transfer("sub.example.com.", 0); err != transfer.ErrNotAuthoritative {
+		t.Errorf("expected ErrNotAuthoritative for a subdomain, got %v", err)
+	}
+}
+
+func TestSerialBefore(t *testing.T) {
+	tests := []struct {
+		a, b     uint32
+		expected bool
+	}{
+		{a: 1, b: 2, expected: true},
+		{a: 2, b: 1, expected: false},
+		{a: 2, b: 2, expected: false},
+		{a: 0xffffffff, b: 1, expected: true},
+	}
+
+	for _, tc := range tests {
+		if got := serialBefore(tc.a, tc.b); got != tc.expected {
+			t.Errorf("serialBefore(%d, %d): expected %t, got %t", tc.a, tc.b, tc.expected, got)
+		}
+	}
+}
+
+func TestIxfrRecords(t *testing.T) {
+	r := &Redis{Nameservers: []string{"ns1.example.net."}}
+	current, old := r.soa("example.com.", 3), r.soa("example.com.", 1)
+	changes := []journalEntry{
+		{Serial: 2, Hostname: "web.example.com", Before: &RedisRecord{IPs: []string{"10.0.0.1"}, TTL: 10}, After: &RedisRecord{IPs: []string{"10.0.0.2"}, TTL: 10}},
+		{Serial: 3, Hostname: "web.example.com", Before: &RedisRecord{IPs: []string{"10.0.0.2"}, TTL: 10}, After: &RedisRecord{IPs: []string{"10.0.0.3"}, TTL: 10}},
+		{Serial: 3, Hostname: "api.example.com", After: &RedisRecord{Targets: map[string][]string{"CNAME": {"web.example.com"}}, TTL: 10}},
+	}
+
+	var got []string
+	for _, rrs := range ixfrRecords(current, old, changes) {
+		for _, rr := range rrs {
+			got = append(got, rr.String())
+		}
+	}
+
+	expected := []string{
+		current.String(),
+		old.String(),
+		"web.example.com.\t10\tIN\tA\t10.0.0.1",
+		current.String(),
+		"api.example.com.\t10\tIN\tCNAME\tweb.example.com.",
+		"web.example.com.\t10\tIN\tA\t10.0.0.3",
+		current.String(),
+	}
+	if len(got) != len(expected) {
+		t.Fatalf("expected %d records, got %d: %v", len(expected), len(got), got)
+	}
+	for i := range expected {
+		if got[i] != expected[i] {
+			t.Errorf("record %d: expected %q, got %q", i, expected[i], got[i])
+		}
+	}
+}
+
+func TestJournalChanges(t *testing.T) {
+	// Serial 4 was journaled after the current serial 3 was read
+	values := []string{
+		`{"serial":4,"hostname":"new.example.com","after":{"ips":["10.0.0.4"],"ttl":10}}`,
+		`{"serial":3,"hostname":"web.example.com","after":{"ips":["10.0.0.3"],"ttl":10}}`,
+		`{"serial":2,"hostname":"other.example.org","after":{"ips":["10.0.0.2"],"ttl":10}}`,
+		`{"serial":1,"hostname":"web.example.com","after":{"ips":["10.0.0.1"],"ttl":10}}`,
+	}
+
+	changes, ok, err := journalChanges(values, "example.com.", 1, 3)
+	if err != nil {
+		t.Fatalf("journalChanges error: %v", err)
+	}
+	if !ok {
+		t.Fatal("expected the journal to reach serial 1")
+	}
+	if len(changes) != 1 || changes[0].Serial != 3 || changes[0].Hostname != "web.example.com" {
+		t.Errorf("expected only the change at serial 3 under the zone, got %+v", changes)
+	}
+
+	if _, ok, _ := journalChanges(values[:2], "example.com.", 1, 3); ok {
+		t.Error("expected a journal missing serial 2 not to reach serial 1")
+	}
+}
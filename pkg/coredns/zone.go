@@ -0,0 +1,163 @@
+package coredns
+
+import (
+	"context"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/coredns/coredns/request"
+	"github.com/miekg/dns"
+	"github.com/redis/go-redis/v9"
+	"github.com/upstash/redis-external-dns/pkg/dnskey"
+	"k8s.io/klog/v2"
+)
+
+// Keys of the zone transfer state written by the controller
+const (
+	serialKey     = "xfr:serial"
+	journalKey    = "xfr:journal"
+	notifyChannel = "xfr:notify"
+)
+
+// Timers of the synthesized SOA records. Records are short-lived, so
+// secondaries refresh often and negative answers are cached briefly.
+const (
+	soaRefresh = 60
+	soaRetry   = 30
+	soaExpire  = 3600
+	soaMinTTL  = 10
+)
+
+// authoritative returns the configured zone matching zone exactly
+func (r *Redis) authoritative(zone string) (string, bool) {
+	zone = strings.ToLower(dns.Fqdn(zone))
+	for _, z := range r.Zones {
+		if z == zone {
+			return z, true
+		}
+	}
+	return "", false
+}
+
+// serial returns the serial of the zones, bumped by the controller on every
+// change to the records served
+func (r *Redis) serial(ctx context.Context) (uint32, error) {
+	value, err := r.client.Get(ctx, serialKey).Result()
+	if err == redis.Nil {
+		return 0, nil
+	}
+	if err != nil {
+		return 0, err
+	}
+	serial, err := strconv.ParseUint(value, 10, 64)
+	if err != nil {
+		return 0, err
+	}
+	return uint32(serial), nil
+}
+
+// soa returns the synthesized SOA record of zone
+func (r *Redis) soa(zone string, serial uint32) *dns.SOA {
+	return &dns.SOA{
+		Hdr:     dns.RR_Header{Name: zone, Rrtype: dns.TypeSOA, Class: dns.ClassINET, Ttl: soaMinTTL},
+		Ns:      r.Nameservers[0],
+		Mbox:    "hostmaster." + zone,
+		Serial:  serial,
+		Refresh: soaRefresh,
+		Retry:   soaRetry,
+		Expire:  soaExpire,
+		Minttl:  soaMinTTL,
+	}
+}
+
+// nsRecords returns the NS records of zone
+func (r *Redis) nsRecords(zone string) []dns.RR {
+	records := make([]dns.RR, 0, len(r.Nameservers))
+	for _, ns := range r.Nameservers {
+		records = append(records, &dns.NS{
+			Hdr: dns.RR_Header{Name: zone, Rrtype: dns.TypeNS, Class: dns.ClassINET, Ttl: r.TTL},
+			Ns:  ns,
+		})
+	}
+	return records
+}
+
+// serveApex answers SOA and NS queries for the apex of a configured zone,
+// which secondaries use to check the serial before transferring the zone
+func (r *Redis) serveApex(ctx context.Context, w dns.ResponseWriter, state request.Request, zone string) (int, error) {
+	serial, err := r.serial(ctx)
+	if err != nil {
+		klog.Errorf("Error reading the serial of %s: %v", zone, err)
+		return dns.RcodeServerFailure, err
+	}
+
+	m := new(dns.Msg)
+	m.SetReply(state.Req)
+	m.Authoritative = true
+	if state.QType() == dns.TypeSOA {
+		m.Answer = []dns.RR{r.soa(zone, serial)}
+		m.Ns = r.nsRecords(zone)
+	} else {
+		m.Answer = r.nsRecords(zone)
+	}
+
+	state.SizeAndDo(m)
+	m = state.Scrub(m)
+	w.WriteMsg(m)
+	return dns.RcodeSuccess, nil
+}
+
+// serveDenial answers a query in a configured zone without matching records:
+// NODATA when the name exists, including as an empty non-terminal above
+// stored names, NXDOMAIN otherwise. The authority section
+// holds the SOA alone, which is what the dnssec plugin expects to add its
+// NSEC denial of existence.
+func (r *Redis) serveDenial(ctx context.Context, w dns.ResponseWriter, state request.Request, zone string) (int, error) {
+	serial, err := r.serial(ctx)
+	if err != nil {
+		klog.Errorf("Error reading the serial of %s: %v", zone, err)
+		return dns.RcodeServerFailure, err
+	}
+
+	exists := state.Name() == zone
+	if !exists {
+		record, err := r.findRecord(state.Name())
+		if err != nil {
+			return dns.RcodeServerFailure, err
+		}
+		exists = record != nil
+	}
+	if !exists {
+		if exists, err = r.hasDescendants(ctx, state.Name()); err != nil {
+			klog.Errorf("Error looking up names below %s: %v", state.Name(), err)
+			return dns.RcodeServerFailure, err
+		}
+	}
+
+	m := new(dns.Msg)
+	m.SetReply(state.Req)
+	m.Authoritative = true
+	m.Ns = []dns.RR{r.soa(zone, serial)}
+	if !exists {
+		m.Rcode = dns.RcodeNameError
+	}
+
+	state.SizeAndDo(m)
+	m = state.Scrub(m)
+	w.WriteMsg(m)
+	return dns.RcodeSuccess, nil
+}
+
+// hasDescendants reports whether a record is stored below qname, which makes
+// qname an empty non-terminal: it exists without records of its own, so
+// resolvers must not deny the names below it (RFC 8020). The controller keeps
+// the subtree index of every name above its records.
+func (r *Redis) hasDescendants(ctx context.Context, qname string) (bool, error) {
+	now := strconv.FormatInt(time.Now().Unix(), 10)
+	count, err := r.client.ZCount(ctx, dnskey.Subtree(qname), now, "+inf").Result()
+	if err != nil {
+		return false, err
+	}
+	return count > 0, nil
+}
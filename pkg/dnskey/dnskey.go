@@ -0,0 +1,67 @@
+// Package dnskey defines the Redis keys of DNS records and of their reverse
+// and subtree indexes. It is shared by the controller and the CoreDNS plugin, and only uses
+// the standard library so the plugin can be built inside the CoreDNS tree.
+package dnskey
+
+import (
+	"net"
+	"strings"
+)
+
+// Prefix is the prefix of every record key
+const Prefix = "dns:"
+
+// ReversePrefix is the prefix of every reverse index key
+const ReversePrefix = "ptr:"
+
+// SubtreePrefix is the prefix of every subtree index key
+const SubtreePrefix = "sub:"
+
+// Canonical returns a hostname in the form records are keyed by: a lowercase
+// fully qualified name with a trailing dot, as DNS queries name it
+func Canonical(hostname string) string {
+	hostname = strings.ToLower(strings.TrimSpace(hostname))
+	if !strings.HasSuffix(hostname, ".") {
+		hostname += "."
+	}
+	return hostname
+}
+
+// Record returns the key of the record of a hostname
+func Record(hostname string) string {
+	return Prefix + Canonical(hostname)
+}
+
+// IsCanonical reports whether key is a record key in canonical form
+func IsCanonical(key string) bool {
+	return strings.HasPrefix(key, Prefix) && key == Record(strings.TrimPrefix(key, Prefix))
+}
+
+// Hostname returns the canonical hostname of a record key
+func Hostname(key string) string {
+	return strings.TrimPrefix(key, Prefix)
+}
+
+// Reverse returns the key of the reverse index of an IP: a sorted set of the
+// hostnames published with the IP, scored by when they expire
+func Reverse(ip net.IP) string {
+	return ReversePrefix + ip.String()
+}
+
+// Subtree returns the key of the subtree index of a name: a sorted set of the
+// hostnames stored below it, scored by when they expire. A name with entries
+// in its subtree index exists even without a record of its own.
+func Subtree(name string) string {
+	return SubtreePrefix + Canonical(name)
+}
+
+// Ancestors returns the canonical names above a hostname, nearest first and
+// without the root
+func Ancestors(hostname string) []string {
+	labels := strings.Split(strings.TrimSuffix(Canonical(hostname), "."), ".")
+	ancestors := make([]string, 0, len(labels))
+	for i := 1; i < len(labels); i++ {
+		ancestors = append(ancestors, strings.Join(labels[i:], ".")+".")
+	}
+	return ancestors
+}
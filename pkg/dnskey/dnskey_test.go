@@ -0,0 +1,74 @@
+package dnskey
+
+import (
+	"net"
+	"reflect"
+	"testing"
+)
+
+func TestRecord(t *testing.T) {
+	tests := []struct {
+		hostname string
+		want     string
+	}{
+		{"web.example.com", "dns:web.example.com."},
+		{"web.example.com.", "dns:web.example.com."},
+		{"Web.Example.COM", "dns:web.example.com."},
+		{" web.example.com. ", "dns:web.example.com."},
+		{"*.apps.example.com", "dns:*.apps.example.com."},
+	}
+	for _, tt := range tests {
+		if got := Record(tt.hostname); got != tt.want {
+			t.Errorf("Record(%q) = %q, want %q", tt.hostname, got, tt.want)
+		}
+	}
+}
+
+func TestIsCanonical(t *testing.T) {
+	tests := []struct {
+		key  string
+		want bool
+	}{
+		{"dns:web.example.com.", true},
+		{"dns:web.example.com", false},
+		{"dns:Web.example.com.", false},
+		{"ptr:10.0.0.1", false},
+	}
+	for _, tt := range tests {
+		if got := IsCanonical(tt.key); got != tt.want {
+			t.Errorf("IsCanonical(%q) = %v, want %v", tt.key, got, tt.want)
+		}
+	}
+}
+
+func TestReverse(t *testing.T) {
+	tests := []struct {
+		ip   string
+		want string
+	}{
+		{"10.0.0.1", "ptr:10.0.0.1"},
+		{"::ffff:10.0.0.1", "ptr:10.0.0.1"},
+		{"2001:DB8::0001", "ptr:2001:db8::1"},
+	}
+	for _, tt := range tests {
+		if got := Reverse(net.ParseIP(tt.ip)); got != tt.want {
+			t.Errorf("Reverse(%q) = %q, want %q", tt.ip, got, tt.want)
+		}
+	}
+}
+
+func TestAncestors(t *testing.T) {
+	tests := []struct {
+		hostname string
+		want     []string
+	}{
+		{"_http._tcp.Example.com", []string{"_tcp.example.com.", "example.com.", "com."}},
+		{"*.apps.example.com.", []string{"apps.example.com.", "example.com.", "com."}},
+		{"com", []string{}},
+	}
+	for _, tt := range tests {
+		if got := Ancestors(tt.hostname); !reflect.DeepEqual(got, tt.want) {
+			t.Errorf("Ancestors(%q) = %v, want %v", tt.hostname, got, tt.want)
+		}
+	}
+}
@@ -8,14 +8,64 @@ import (
 	"time"
 
 	"github.com/redis/go-redis/v9"
+	"github.com/upstash/redis-external-dns/pkg/dnskey"
 )
 
-// DNSRecord represents a DNS record in Redis
+// DNSRecord represents a DNS record in Redis. IPs holds both the A and the
+// AAAA addresses of a name.
 type DNSRecord struct {
 	IPs       []string          `json:"ips"`
 	TTL       int               `json:"ttl"`
 	Metadata  map[string]string `json:"metadata,omitempty"`
 	UpdatedAt time.Time         `json:"updated_at"`
+	// PodHostnames lists the pod hostnames published as <pod>.<hostname>
+	// records for headless services
+	PodHostnames []string `json:"pod_hostnames,omitempty"`
+	// Targets holds the record data for types other than A and AAAA, keyed by
+	// record type (CNAME, TXT, SRV)
+	Targets map[string][]string `json:"targets,omitempty"`
+	// Endpoints describes where each of the IPs runs, for topology-aware answers
+	Endpoints []Endpoint `json:"endpoints,omitempty"`
+	// Clusters tracks the clusters publishing endpoints for the hostname
+	Clusters map[string]ClusterState `json:"clusters,omitempty"`
+	// Policy selects which clusters answer for the hostname. In a shared
+	// record it is the policy declared by one of the Clusters.
+	Policy *FailoverPolicy `json:"policy,omitempty"`
+}
+
+// ClusterState tracks a cluster publishing endpoints for a hostname
+type ClusterState struct {
+	// Heartbeat is the last time the cluster's controller wrote the record
+	Heartbeat time.Time `json:"heartbeat"`
+	// UpdatedAt is when the cluster last published its endpoints
+	UpdatedAt time.Time `json:"updated_at"`
+	// Policy is the failover policy the cluster declares for the hostname
+	Policy *FailoverPolicy `json:"policy,omitempty"`
+}
+
+// FailoverPolicy serves the endpoints of a primary cluster while it is
+// healthy, and those of the secondary clusters otherwise. A cluster is healthy
+// while it has endpoints and its heartbeat is at most StaleAfter seconds old.
+type FailoverPolicy struct {
+	Primary string `json:"primary"`
+	// Secondaries lists the clusters to fail over to in order of preference;
+	// when empty every other cluster is used
+	Secondaries []string `json:"secondaries,omitempty"`
+	StaleAfter  int      `json:"stale_after,omitempty"`
+}
+
+// Endpoint describes a published IP and its location
+type Endpoint struct {
+	IP      string `json:"ip"`
+	Zone    string `json:"zone,omitempty"`
+	Node    string `json:"node,omitempty"`
+	Cluster string `json:"cluster,omitempty"`
+	// Region is the region of the cluster, for routing clients to the nearest one
+	Region string `json:"region,omitempty"`
+	// Weight is the relative share of answers for the endpoint; zero means 1
+	Weight int `json:"weight,omitempty"`
+	// Hints lists the zones the endpoint should serve, from EndpointSlice hints
+	Hints []string `json:"hints,omitempty"`
 }
 
 // RedisClient handles Redis operations for DNS records
@@ -28,8 +78,30 @@ type Client interface {
 	SetRecord(ctx context.Context, hostname string, record *DNSRecord) error
 	GetRecord(ctx context.Context, hostname string) (*DNSRecord, error)
 	DeleteRecord(ctx context.Context, hostname string) error
+	UpdateRecord(ctx context.Context, hostname string, update UpdateFunc) error
+	Ping(ctx context.Context) error
+	MigrateKeys(ctx context.Context) (int, error)
 }
 
+// UpdateFunc computes the new record of a hostname from its current record,
+// which is nil when none exists. Returning a nil record deletes it.
+type UpdateFunc func(current *DNSRecord) (*DNSRecord, error)
+
+// minRecordExpiry is the shortest time a record is kept in Redis after it was
+// last written, whatever its TTL. The controller rewrites its records on every
+// reconcile, every 5 seconds, so records with a short TTL do not expire in
+// between.
+const minRecordExpiry = 30 * time.Second
+
+// recordExpiry returns how long a record is kept in Redis after it was written
+func recordExpiry(record *DNSRecord) time.Duration {
+	return max(time.Duration(record.TTL)*time.Second, minRecordExpiry)
+}
+
+// maxUpdateRetries bounds the attempts of UpdateRecord when the record keeps
+// changing concurrently
+const maxUpdateRetries = 10
+
 // Option configures the Redis client
 type Option func(*redis.Options)
 
@@ -63,25 +135,21 @@ func NewClient(addr, password string, options ...Option) (Client, error) {
 	return &RedisClient{rdb: rdb}, nil
 }
 
+// Ping checks that Redis is reachable
+func (c *RedisClient) Ping(ctx context.Context) error {
+	return c.rdb.Ping(ctx).Err()
+}
+
 // SetRecord sets a DNS record in Redis
 func (c *RedisClient) SetRecord(ctx context.Context, hostname string, record *DNSRecord) error {
-	data, err := json.Marshal(record)
-	if err != nil {
-		return fmt.Errorf("failed to marshal record: %v", err)
-	}
-
-	key := fmt.Sprintf("dns:%s", hostname)
-	if err := c.rdb.Set(ctx, key, string(data), time.Duration(record.TTL)*time.Second).Err(); err != nil {
-		return fmt.Errorf("failed to set record: %v", err)
-	}
-
-	key = fmt.Sprintf("%s.", key)
-	return c.rdb.Set(ctx, key, string(data), time.Duration(record.TTL)*time.Second).Err()
+	return c.UpdateRecord(ctx, hostname, func(*DNSRecord) (*DNSRecord, error) {
+		return record, nil
+	})
 }
 
 // GetRecord gets a DNS record from Redis
 func (c *RedisClient) GetRecord(ctx context.Context, hostname string) (*DNSRecord, error) {
-	key := fmt.Sprintf("dns:%s", hostname)
+	key := dnskey.Record(hostname)
 	data, err := c.rdb.Get(ctx, key).Result()
 	if err != nil {
 		if err == redis.Nil {
@@ -100,12 +168,137 @@ func (c *RedisClient) GetRecord(ctx context.Context, hostname string) (*DNSRecor
 
 // DeleteRecord deletes a DNS record from Redis
 func (c *RedisClient) DeleteRecord(ctx context.Context, hostname string) error {
-	key := fmt.Sprintf("dns:%s", hostname)
-	err := c.rdb.Del(ctx, key).Err()
-	if err != nil {
-		return fmt.Errorf("failed to delete record: %v", err)
+	return c.UpdateRecord(ctx, hostname, func(*DNSRecord) (*DNSRecord, error) {
+		return nil, nil
+	})
+}
+
+// UpdateRecord atomically replaces the DNS record of a hostname with the
+// result of update, along with the reverse index of its IPs and the zone
+// transfer journal. The update is retried when another writer changes the
+// record in the meantime, such as the controller of another cluster.
+func (c *RedisClient) UpdateRecord(ctx context.Context, hostname string, update UpdateFunc) error {
+	key := dnskey.Record(hostname)
+
+	txf := func(tx *redis.Tx) error {
+		var current *DNSRecord
+		data, err := tx.Get(ctx, key).Result()
+		switch {
+		case err == redis.Nil:
+		case err != nil:
+			return err
+		default:
+			current = &DNSRecord{}
+			if err := json.Unmarshal([]byte(data), current); err != nil {
+				return fmt.Errorf("failed to unmarshal record: %v", err)
+			}
+		}
+
+		record, err := update(current)
+		if err != nil {
+			return err
+		}
+
+		_, err = tx.TxPipelined(ctx, func(pipe redis.Pipeliner) error {
+			indexReverse(ctx, pipe, hostname, current, record)
+			indexSubtree(ctx, pipe, hostname, record)
+			if err := journalChange(ctx, pipe, hostname, current, record); err != nil {
+				return err
+			}
+			if record == nil {
+				pipe.Del(ctx, key)
+				return nil
+			}
+
+			data, err := json.Marshal(record)
+			if err != nil {
+				return fmt.Errorf("failed to marshal record: %v", err)
+			}
+			pipe.Set(ctx, key, string(data), recordExpiry(record))
+			return nil
+		})
+		return err
 	}
 
-	key = fmt.Sprintf("%s.", key)
-	return c.rdb.Del(ctx, key).Err()
+	for i := 0; i < maxUpdateRetries; i++ {
+		err := c.rdb.Watch(ctx, txf, key)
+		if err == redis.TxFailedErr {
+			continue
+		}
+		return err
+	}
+	return fmt.Errorf("failed to update record: too many concurrent updates of %s", hostname)
+}
+
+// MigrateKeys moves the records stored under keys that are not canonical,
+// such as the undotted duplicates written by earlier versions, to their
+// canonical key. A record whose canonical key already exists is dropped, as
+// the canonical one is what the plugin serves. It returns the number of keys
+// migrated.
+func (c *RedisClient) MigrateKeys(ctx context.Context) (int, error) {
+	var keys []string
+	iter := c.rdb.Scan(ctx, 0, dnskey.Prefix+"*", 1000).Iterator()
+	for iter.Next(ctx) {
+		if !dnskey.IsCanonical(iter.Val()) {
+			keys = append(keys, iter.Val())
+		}
+	}
+	if err := iter.Err(); err != nil {
+		return 0, fmt.Errorf("failed to scan records: %v", err)
+	}
+
+	migrated := 0
+	for _, key := range keys {
+		if err := c.migrateKey(ctx, key); err != nil {
+			return migrated, fmt.Errorf("failed to migrate %s: %v", key, err)
+		}
+		migrated++
+	}
+	return migrated, nil
+}
+
+// migrateKey moves the record under a non-canonical key to its canonical key,
+// keeping its expiry, unless the canonical key exists
+func (c *RedisClient) migrateKey(ctx context.Context, key string) error {
+	canonical := dnskey.Record(dnskey.Hostname(key))
+
+	txf := func(tx *redis.Tx) error {
+		data, err := tx.Get(ctx, key).Result()
+		if err == redis.Nil {
+			// Expired since the scan
+			return nil
+		}
+		if err != nil {
+			return err
+		}
+		ttl, err := tx.PTTL(ctx, key).Result()
+		if err != nil {
+			return err
+		}
+		exists, err := tx.Exists(ctx, canonical).Result()
+		if err != nil {
+			return err
+		}
+
+		_, err = tx.TxPipelined(ctx, func(pipe redis.Pipeliner) error {
+			if exists == 0 {
+				if ttl < 0 {
+					ttl = 0
+				}
+				pipe.Set(ctx, canonical, data, ttl)
+			}
+			pipe.Del(ctx, key)
+			return nil
+		})
+		return err
+	}
+
+	for i := 0; i < maxUpdateRetries; i++ {
+		err := c.rdb.Watch(ctx, txf, key, canonical)
+		if err == redis.TxFailedErr {
+			continue
+		}
+		return err
+	}
+	return fmt.Errorf("too many concurrent updates")
 }
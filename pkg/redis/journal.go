@@ -0,0 +1,89 @@
+package redis
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"reflect"
+	"sort"
+
+	"github.com/redis/go-redis/v9"
+)
+
+// Keys of the zone transfer state shared with the CoreDNS plugin
+const (
+	// serialKey holds the zone serial, incremented on every served change
+	serialKey = "xfr:serial"
+	// journalKey holds the most recent changes, newest first, for IXFR
+	journalKey = "xfr:journal"
+	// notifyChannel receives the hostname of every served change, so the
+	// plugin can send NOTIFY to secondary servers
+	notifyChannel = "xfr:notify"
+)
+
+// maxJournalEntries bounds the journal; secondaries further behind fall back
+// to a full zone transfer
+const maxJournalEntries = 1000
+
+// journalEntry records a change to the records served for a hostname. Only
+// the served fields of the records are kept; a nil record means none existed.
+// The serial of the change is added by journalScript.
+type journalEntry struct {
+	Hostname string     `json:"hostname"`
+	Before   *DNSRecord `json:"before,omitempty"`
+	After    *DNSRecord `json:"after,omitempty"`
+}
+
+// journalScript increments the serial and prepends the entry in ARGV[1],
+// which lacks its serial, to the journal. The entry is spliced as text so its
+// JSON comes back exactly as written.
+const journalScript = `
+local serial = redis.call('INCR', KEYS[1])
+local entry = '{"serial":' .. serial .. ',' .. string.sub(ARGV[1], 2)
+redis.call('LPUSH', KEYS[2], entry)
+redis.call('LTRIM', KEYS[2], 0, tonumber(ARGV[2]) - 1)
+redis.call('PUBLISH', ARGV[3], ARGV[4])
+return serial
+`
+
+// journalChange adds a journal entry and bumps the serial when the records
+// served for hostname change. Rewrites that only refresh a record, such as
+// the periodic reconciliation, are not journaled. Records expiring without
+// being deleted are not journaled either, so secondaries rely on the SOA
+// expire timer for those.
+func journalChange(ctx context.Context, pipe redis.Pipeliner, hostname string, previous, record *DNSRecord) error {
+	before, after := servedRecord(previous), servedRecord(record)
+	if reflect.DeepEqual(before, after) {
+		return nil
+	}
+
+	data, err := json.Marshal(journalEntry{Hostname: hostname, Before: before, After: after})
+	if err != nil {
+		return fmt.Errorf("failed to marshal journal entry: %v", err)
+	}
+
+	pipe.Eval(ctx, journalScript, []string{serialKey, journalKey}, string(data), maxJournalEntries, notifyChannel, hostname)
+	return nil
+}
+
+// servedRecord returns the fields of a record that DNS answers are built
+// from, normalised for comparison
+func servedRecord(record *DNSRecord) *DNSRecord {
+	if record == nil || (len(record.IPs) == 0 && len(record.Targets) == 0) {
+		return nil
+	}
+
+	served := &DNSRecord{
+		IPs: append([]string(nil), record.IPs...),
+		TTL: record.TTL,
+	}
+	sort.Strings(served.IPs)
+	if len(record.Targets) > 0 {
+		served.Targets = make(map[string][]string, len(record.Targets))
+		for recordType, targets := range record.Targets {
+			served.Targets[recordType] = append([]string(nil), targets...)
+			sort.Strings(served.Targets[recordType])
+		}
+	}
+	return served
+}
@@ -0,0 +1,58 @@
+package redis
+
+import (
+	"context"
+	"fmt"
+	"net"
+	"strings"
+	"time"
+
+	"github.com/redis/go-redis/v9"
+	"github.com/upstash/redis-external-dns/pkg/dnskey"
+)
+
+// reverseKey returns the key of the reverse index of an IP, unless it is invalid
+func reverseKey(ip string) (string, bool) {
+	parsed := net.ParseIP(ip)
+	if parsed == nil {
+		return "", false
+	}
+	return dnskey.Reverse(parsed), true
+}
+
+// indexReverse points the IPs of record back at hostname, and removes hostname
+// from the IPs of the previous record it no longer has. Either record may be
+// nil. Wildcard hostnames are not indexed.
+func indexReverse(ctx context.Context, pipe redis.Pipeliner, hostname string, previous, record *DNSRecord) {
+	if strings.HasPrefix(hostname, "*.") {
+		return
+	}
+
+	now := time.Now()
+	current := make(map[string]bool)
+	if record != nil {
+		ttl := recordExpiry(record)
+		for _, ip := range record.IPs {
+			key, ok := reverseKey(ip)
+			if !ok {
+				continue
+			}
+			current[key] = true
+			pipe.ZAdd(ctx, key, redis.Z{Score: float64(now.Add(ttl).Unix()), Member: hostname})
+			pipe.ZRemRangeByScore(ctx, key, "-inf", fmt.Sprintf("(%d", now.Unix()))
+			// Only ever extend the expiry of the set, which holds the entries
+			// of other hostnames with the IP; GT alone never sets the expiry
+			// of a set without one
+			pipe.ExpireNX(ctx, key, ttl)
+			pipe.ExpireGT(ctx, key, ttl)
+		}
+	}
+
+	if previous != nil {
+		for _, ip := range previous.IPs {
+			if key, ok := reverseKey(ip); ok && !current[key] {
+				pipe.ZRem(ctx, key, hostname)
+			}
+		}
+	}
+}
@@ -0,0 +1,34 @@
+package redis
+
+import (
+	"context"
+	"fmt"
+	"time"
+
+	"github.com/redis/go-redis/v9"
+	"github.com/upstash/redis-external-dns/pkg/dnskey"
+)
+
+// indexSubtree adds hostname to the subtree index of each of its ancestors,
+// or removes it from them when record is nil. The plugin looks the index up
+// to answer NODATA rather than NXDOMAIN for names that only exist because of
+// the names below them, such as _tcp.example.com under _http._tcp.example.com.
+// Indexes left without entries are deleted by Redis.
+func indexSubtree(ctx context.Context, pipe redis.Pipeliner, hostname string, record *DNSRecord) {
+	member := dnskey.Canonical(hostname)
+	now := time.Now()
+	for _, ancestor := range dnskey.Ancestors(hostname) {
+		key := dnskey.Subtree(ancestor)
+		if record == nil {
+			pipe.ZRem(ctx, key, member)
+			continue
+		}
+
+		ttl := recordExpiry(record)
+		pipe.ZAdd(ctx, key, redis.Z{Score: float64(now.Add(ttl).Unix()), Member: member})
+		pipe.ZRemRangeByScore(ctx, key, "-inf", fmt.Sprintf("(%d", now.Unix()))
+		// As with the reverse index, only ever extend the expiry of the set
+		pipe.ExpireNX(ctx, key, ttl)
+		pipe.ExpireGT(ctx, key, ttl)
+	}
+}